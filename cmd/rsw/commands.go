@@ -0,0 +1,376 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+
+	rediswrapper "github.com/a-agmon/redis-streams-wrapper/v1"
+)
+
+// produceBatchSize is the number of stdin lines produced per round trip
+const produceBatchSize = 100
+
+// fieldsFlag collects repeated -field key=value flags
+type fieldsFlag map[string]interface{}
+
+func (f fieldsFlag) String() string {
+	return formatFields(f)
+}
+
+func (f fieldsFlag) Set(value string) error {
+	key, val, ok := strings.Cut(value, "=")
+	if !ok || key == "" {
+		return fmt.Errorf("field %q must be key=value", value)
+	}
+	f[key] = val
+	return nil
+}
+
+func produceCommand(fs *flag.FlagSet) runner {
+	stream := fs.String("stream", "", "stream to produce to (required)")
+	fields := fieldsFlag{}
+	fs.Var(fields, "field", "message field as key=value, can be repeated")
+	jsonPayload := fs.String("json", "", "message fields as a JSON object")
+	return func(ctx context.Context, env *env) error {
+		if err := required("stream", *stream); err != nil {
+			return err
+		}
+		if len(fields) > 0 && *jsonPayload != "" {
+			return fmt.Errorf("use either -field or -json")
+		}
+		if len(fields) > 0 {
+			return produce(ctx, env, *stream, []map[string]interface{}{fields})
+		}
+		if *jsonPayload != "" {
+			payload, err := decodePayload(*jsonPayload)
+			if err != nil {
+				return err
+			}
+			return produce(ctx, env, *stream, []map[string]interface{}{payload})
+		}
+		// read one JSON object per line from stdin
+		scanner := bufio.NewScanner(env.stdin)
+		scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+		batch := make([]map[string]interface{}, 0, produceBatchSize)
+		for line := 1; scanner.Scan(); line++ {
+			text := strings.TrimSpace(scanner.Text())
+			if text == "" {
+				continue
+			}
+			payload, err := decodePayload(text)
+			if err != nil {
+				return fmt.Errorf("line %d: %v", line, err)
+			}
+			batch = append(batch, payload)
+			if len(batch) == produceBatchSize {
+				if err = produce(ctx, env, *stream, batch); err != nil {
+					return err
+				}
+				batch = batch[:0]
+			}
+		}
+		if err := scanner.Err(); err != nil {
+			return fmt.Errorf("error reading stdin: %v", err)
+		}
+		return produce(ctx, env, *stream, batch)
+	}
+}
+
+func produce(ctx context.Context, env *env, stream string, payloads []map[string]interface{}) error {
+	if len(payloads) == 0 {
+		return nil
+	}
+	ids, err := env.client.ProduceMessages(ctx, stream, payloads)
+	if err != nil {
+		return err
+	}
+	return env.out.ids(stream, ids)
+}
+
+func decodePayload(text string) (map[string]interface{}, error) {
+	// numbers are kept as written, a float64 would round integers above 2^53
+	decoder := json.NewDecoder(strings.NewReader(text))
+	decoder.UseNumber()
+	var payload map[string]interface{}
+	if err := decoder.Decode(&payload); err != nil {
+		return nil, fmt.Errorf("payload must be a JSON object: %v", err)
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, fmt.Errorf("payload must be a single JSON object")
+	}
+	// nested values can't be stored as fields, keep them as JSON text
+	for key, value := range payload {
+		switch value := value.(type) {
+		case json.Number:
+			payload[key] = value.String()
+		case map[string]interface{}, []interface{}:
+			encoded, err := json.Marshal(value)
+			if err != nil {
+				return nil, err
+			}
+			payload[key] = string(encoded)
+		case nil:
+			payload[key] = ""
+		}
+	}
+	return payload, nil
+}
+
+func consumeCommand(fs *flag.FlagSet) runner {
+	stream := fs.String("stream", "", "stream to consume (required)")
+	group := fs.String("group", "", "consumer group, created when missing (required)")
+	count := fs.Int("count", 10, "maximum number of messages per fetch")
+	wait := fs.Int("wait", 1, "seconds to block waiting for messages")
+	ack := fs.Bool("ack", false, "ack the messages once printed")
+	follow := fs.Bool("follow", false, "keep fetching until interrupted")
+	return func(ctx context.Context, env *env) error {
+		if err := required("stream", *stream, "group", *group); err != nil {
+			return err
+		}
+		for {
+			messages, err := env.client.FetchNewMessages(ctx, *stream, *group, *count, *wait)
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+				return err
+			}
+			if err = env.out.messages(messages); err != nil {
+				return err
+			}
+			if *ack {
+				for _, message := range messages {
+					if err = env.client.AckMessage(ctx, *stream, *group, message.ID); err != nil {
+						return err
+					}
+				}
+			}
+			if !*follow || ctx.Err() != nil {
+				return nil
+			}
+		}
+	}
+}
+
+func tailCommand(fs *flag.FlagSet) runner {
+	streams := fs.String("stream", "", "streams to read, comma separated (required)")
+	from := fs.String("from", "$", "read after this ID, 0 for the beginning and $ for new messages only")
+	count := fs.Int("count", 100, "maximum number of messages per read")
+	checkpoint := fs.String("checkpoint", "", "hash key to resume from and save the last IDs to")
+	follow := fs.Bool("follow", true, "keep reading new messages until interrupted, otherwise stop at the end of the streams")
+	return func(ctx context.Context, env *env) error {
+		if err := required("stream", *streams); err != nil {
+			return err
+		}
+		config := rediswrapper.TailConfig{
+			Streams:        strings.Split(*streams, ","),
+			From:           *from,
+			CheckpointKey:  *checkpoint,
+			BatchSize:      *count,
+			WaitForSeconds: -1,
+		}
+		if *follow {
+			config.WaitForSeconds = 1
+		}
+		tailer, err := env.client.Tail(ctx, config)
+		if err != nil {
+			return err
+		}
+		for {
+			messages, err := tailer.Next(ctx)
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil
+				}
+				return err
+			}
+			if err = env.out.messages(messages); err != nil {
+				return err
+			}
+			if (!*follow && len(messages) == 0) || ctx.Err() != nil {
+				return nil
+			}
+		}
+	}
+}
+
+func pendingCommand(fs *flag.FlagSet) runner {
+	stream := fs.String("stream", "", "stream of the group (required)")
+	group := fs.String("group", "", "consumer group (required)")
+	owner := fs.String("owner", "", "only list entries owned by this consumer")
+	minIdle := fs.Duration("min-idle", 0, "only list entries delivered at least this long ago")
+	count := fs.Int64("count", 100, "maximum number of entries listed, 0 for all")
+	streamRange := rangeFlags(fs)
+	return func(ctx context.Context, env *env) error {
+		if err := required("stream", *stream, "group", *group); err != nil {
+			return err
+		}
+		filter := rediswrapper.PendingFilter{Consumer: *owner, MinIdle: *minIdle, Count: *count}
+		var err error
+		if filter.StreamRange, err = streamRange(); err != nil {
+			return err
+		}
+		entries, err := env.client.ListPending(ctx, *stream, *group, filter)
+		if err != nil {
+			return err
+		}
+		return env.out.pending(entries)
+	}
+}
+
+func claimCommand(fs *flag.FlagSet) runner {
+	stream := fs.String("stream", "", "stream of the group (required)")
+	group := fs.String("group", "", "consumer group (required)")
+	to := fs.String("to", "", "consumer to assign the entries to, the -consumer of rsw by default")
+	return func(ctx context.Context, env *env) error {
+		if err := required("stream", *stream, "group", *group); err != nil {
+			return err
+		}
+		if len(env.args) == 0 {
+			return fmt.Errorf("no message IDs given, usage: rsw claim -stream s -group g [-to c] id...")
+		}
+		consumer := *to
+		if consumer == "" {
+			consumer = env.client.Config.ConsumerName
+		}
+		messages, err := env.client.ClaimMessagesTo(ctx, *stream, *group, consumer, env.args)
+		if err != nil {
+			return err
+		}
+		return env.out.messages(messages)
+	}
+}
+
+type ackRecord struct {
+	Stream string `json:"stream"`
+	Group  string `json:"group"`
+	Acked  int64  `json:"acked"`
+}
+
+func ackCommand(fs *flag.FlagSet) runner {
+	stream := fs.String("stream", "", "stream of the group (required)")
+	group := fs.String("group", "", "consumer group (required)")
+	return func(ctx context.Context, env *env) error {
+		if err := required("stream", *stream, "group", *group); err != nil {
+			return err
+		}
+		if len(env.args) == 0 {
+			return fmt.Errorf("no message IDs given, usage: rsw ack -stream s -group g id...")
+		}
+		acked, err := env.client.ForceAck(ctx, *stream, *group, env.args)
+		if err != nil {
+			return err
+		}
+		return env.out.print(ackRecord{Stream: *stream, Group: *group, Acked: acked}, []string{"STREAM", "GROUP", "ACKED"},
+			[]string{*stream, *group, fmt.Sprint(acked)})
+	}
+}
+
+func deadLetterCommand(fs *flag.FlagSet) runner {
+	stream := fs.String("stream", "", "stream of the group (required)")
+	group := fs.String("group", "", "consumer group (required)")
+	deadLetterStream := fs.String("dlq", "", "dead letter stream the entries are moved to (required)")
+	reason := fs.String("reason", "moved manually", "reason stored with the entries")
+	return func(ctx context.Context, env *env) error {
+		if err := required("stream", *stream, "group", *group, "dlq", *deadLetterStream); err != nil {
+			return err
+		}
+		if len(env.args) == 0 {
+			return fmt.Errorf("no message IDs given, usage: rsw dlq -stream s -group g -dlq d id...")
+		}
+		moved, err := env.client.MovePendingToDeadLetter(ctx, *stream, *group, *deadLetterStream, *reason, env.args)
+		if printErr := env.out.ids(*stream, moved); err == nil {
+			err = printErr
+		}
+		return err
+	}
+}
+
+func groupsCommand(fs *flag.FlagSet) runner {
+	stream := fs.String("stream", "", "stream to inspect (required)")
+	return func(ctx context.Context, env *env) error {
+		if err := required("stream", *stream); err != nil {
+			return err
+		}
+		groups, err := env.client.GroupsInfo(ctx, *stream)
+		if err != nil {
+			return err
+		}
+		return env.out.groups(groups)
+	}
+}
+
+// required checks that flags are set, it takes pairs of flag name and value
+func required(nameValues ...string) error {
+	for i := 0; i+1 < len(nameValues); i += 2 {
+		if nameValues[i+1] == "" {
+			return fmt.Errorf("-%s is required", nameValues[i])
+		}
+	}
+	return nil
+}
+
+type moveRecord struct {
+	Stream      string `json:"stream"`
+	Group       string `json:"group"`
+	FromID      string `json:"from_id"`
+	ToID        string `json:"to_id"`
+	Redelivered int64  `json:"redelivered"`
+	Skipped     int64  `json:"skipped"`
+	DryRun      bool   `json:"dry_run"`
+}
+
+func moveCommand(fs *flag.FlagSet) runner {
+	stream := fs.String("stream", "", "stream of the group (required)")
+	group := fs.String("group", "", "consumer group (required)")
+	toID := fs.String("to-id", "", "move the group to this ID, 0 to re-deliver the whole stream")
+	toTime := fs.String("to-time", "", "move the group to deliver entries added from this time, RFC3339 or a duration ago such as 2h")
+	toEnd := fs.Bool("to-end", false, "move the group to the end of the stream, skipping undelivered entries")
+	dryRun := fs.Bool("dry-run", false, "only report how many entries would be re-delivered or skipped")
+	return func(ctx context.Context, env *env) error {
+		if err := required("stream", *stream, "group", *group); err != nil {
+			return err
+		}
+		var move *rediswrapper.GroupMove
+		var err error
+		switch {
+		case *toID != "" && *toTime == "" && !*toEnd:
+			move, err = env.client.MoveGroupToID(ctx, *stream, *group, *toID, *dryRun)
+		case *toTime != "" && *toID == "" && !*toEnd:
+			t, parseErr := parseTime(*toTime)
+			if parseErr != nil {
+				return fmt.Errorf("invalid -to-time: %v", parseErr)
+			}
+			move, err = env.client.MoveGroupToTime(ctx, *stream, *group, t, *dryRun)
+		case *toEnd && *toID == "" && *toTime == "":
+			move, err = env.client.MoveGroupToEnd(ctx, *stream, *group, *dryRun)
+		default:
+			return fmt.Errorf("use exactly one of -to-id, -to-time and -to-end")
+		}
+		if err != nil {
+			return err
+		}
+		record := moveRecord{
+			Stream:      move.StreamName,
+			Group:       move.ConsumerGroup,
+			FromID:      move.FromID,
+			ToID:        move.ToID,
+			Redelivered: move.Redelivered,
+			Skipped:     move.Skipped,
+			DryRun:      move.DryRun,
+		}
+		return env.out.print(record, []string{"GROUP", "FROM", "TO", "REDELIVERED", "SKIPPED", "DRY RUN"}, []string{
+			move.ConsumerGroup,
+			move.FromID,
+			move.ToID,
+			fmt.Sprint(move.Redelivered),
+			fmt.Sprint(move.Skipped),
+			fmt.Sprint(move.DryRun),
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	rediswrapper "github.com/a-agmon/redis-streams-wrapper/v1"
+)
+
+// rangeFlags registers the flags selecting a range of entries
+func rangeFlags(fs *flag.FlagSet) func() (rediswrapper.StreamRange, error) {
+	start := fs.String("start", "", "first ID included")
+	end := fs.String("end", "", "last ID included")
+	since := fs.String("since", "", "exclude entries added before this time, RFC3339 or a duration ago such as 2h")
+	until := fs.String("until", "", "exclude entries added from this time on, RFC3339 or a duration ago such as 30m")
+	return func() (rediswrapper.StreamRange, error) {
+		streamRange := rediswrapper.StreamRange{Start: *start, End: *end}
+		var err error
+		if streamRange.Since, err = parseTime(*since); err != nil {
+			return streamRange, fmt.Errorf("invalid -since: %v", err)
+		}
+		if streamRange.Until, err = parseTime(*until); err != nil {
+			return streamRange, fmt.Errorf("invalid -until: %v", err)
+		}
+		return streamRange, nil
+	}
+}
+
+// parseTime parses an RFC3339 time or a duration before now, an empty value is the zero time
+func parseTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if ago, err := time.ParseDuration(value); err == nil {
+		return time.Now().Add(-ago), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+func exportCommand(fs *flag.FlagSet) runner {
+	stream := fs.String("stream", "", "stream to export (required)")
+	file := fs.String("file", "", "file to write, stdout by default")
+	streamRange := rangeFlags(fs)
+	return func(ctx context.Context, env *env) error {
+		if err := required("stream", *stream); err != nil {
+			return err
+		}
+		opts := rediswrapper.ExportOptions{}
+		var err error
+		if opts.StreamRange, err = streamRange(); err != nil {
+			return err
+		}
+		w := env.stdout
+		if *file != "" {
+			f, err := os.Create(*file)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			w = f
+		}
+		_, err = env.client.ExportStream(ctx, *stream, w, opts)
+		return err
+	}
+}
+
+type importRecord struct {
+	Stream   string `json:"stream"`
+	Imported int    `json:"imported"`
+}
+
+func importCommand(fs *flag.FlagSet) runner {
+	stream := fs.String("stream", "", "stream to import into (required)")
+	file := fs.String("file", "", "file to read, stdin by default")
+	preserveIDs := fs.Bool("preserve-ids", false, "keep the exported IDs instead of generating new ones")
+	streamRange := rangeFlags(fs)
+	return func(ctx context.Context, env *env) error {
+		if err := required("stream", *stream); err != nil {
+			return err
+		}
+		opts := rediswrapper.ImportOptions{PreserveIDs: *preserveIDs}
+		var err error
+		if opts.StreamRange, err = streamRange(); err != nil {
+			return err
+		}
+		var rd io.Reader = env.stdin
+		if *file != "" {
+			f, err := os.Open(*file)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			rd = f
+		}
+		imported, err := env.client.ImportStream(ctx, *stream, rd, opts)
+		printErr := env.out.print(importRecord{Stream: *stream, Imported: imported}, []string{"STREAM", "IMPORTED"},
+			[]string{*stream, fmt.Sprint(imported)})
+		if err != nil {
+			return err
+		}
+		return printErr
+	}
+}
@@ -0,0 +1,164 @@
+// Command rsw inspects and manipulates redis streams from the command line.
+//
+// Usage:
+//
+//	rsw <command> [flags]
+//
+// Commands:
+//
+//	produce   produce messages from -field flags, a -json object, or JSON objects read from stdin (one per line)
+//	consume   fetch messages with a consumer group, optionally acking them
+//	tail      read messages of one or more streams without a consumer group, following them for new ones
+//	pending   list the pending entries of a consumer group
+//	claim     claim pending entries by ID for a consumer
+//	ack       ack entries by ID, whoever owns them
+//	dlq       move pending entries by ID to a dead letter stream
+//	groups    list the consumer groups of a stream
+//	move      rewind or fast-forward a consumer group, with -dry-run to only count the entries affected
+//	export    write the entries of a stream as JSON lines
+//	import    add entries read as JSON lines to a stream
+//
+// Every command accepts -addr, -username, -password, -db, -consumer, -output (table or json) and -v.
+// The consumer defaults to rsw-<hostname>, so repeated runs on a host share one consumer in the group.
+// The address defaults to the RSW_ADDR environment variable, or localhost:6379
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	rediswrapper "github.com/a-agmon/redis-streams-wrapper/v1"
+)
+
+// command is a subcommand of rsw. setup registers the flags of the command and returns the function running it
+type command struct {
+	name    string
+	summary string
+	setup   func(fs *flag.FlagSet) runner
+}
+
+// runner runs a command once the flags were parsed
+type runner func(ctx context.Context, env *env) error
+
+// env is what a command runs with
+type env struct {
+	client *rediswrapper.RedisStreamsClient
+	out    *printer
+	stdin  io.Reader
+	stdout io.Writer
+	args   []string
+}
+
+var commands = []command{
+	{"produce", "produce messages to a stream", produceCommand},
+	{"consume", "fetch messages with a consumer group", consumeCommand},
+	{"tail", "read messages without a consumer group", tailCommand},
+	{"pending", "list the pending entries of a consumer group", pendingCommand},
+	{"claim", "claim pending entries by ID", claimCommand},
+	{"ack", "ack entries by ID", ackCommand},
+	{"dlq", "move pending entries by ID to a dead letter stream", deadLetterCommand},
+	{"groups", "list the consumer groups of a stream", groupsCommand},
+	{"move", "rewind or fast-forward a consumer group", moveCommand},
+	{"export", "write the entries of a stream as JSON lines", exportCommand},
+	{"import", "add entries read as JSON lines to a stream", importCommand},
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	os.Exit(run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run executes the command line and returns the exit code
+func run(ctx context.Context, args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) int {
+	if len(args) == 0 || args[0] == "-h" || args[0] == "-help" || args[0] == "help" {
+		usage(stderr)
+		return 2
+	}
+	var cmd *command
+	for i := range commands {
+		if commands[i].name == args[0] {
+			cmd = &commands[i]
+		}
+	}
+	if cmd == nil {
+		fmt.Fprintf(stderr, "rsw: unknown command %q\n", args[0])
+		usage(stderr)
+		return 2
+	}
+	fs := flag.NewFlagSet("rsw "+cmd.name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	addr := fs.String("addr", envOr("RSW_ADDR", "localhost:6379"), "redis address")
+	username := fs.String("username", "", "redis username")
+	password := fs.String("password", os.Getenv("RSW_PASSWORD"), "redis password, RSW_PASSWORD by default")
+	db := fs.Int("db", 0, "redis database")
+	consumer := fs.String("consumer", "", "consumer name, rsw-<hostname> when empty")
+	output := fs.String("output", "table", "output format, table or json")
+	verbose := fs.Bool("v", false, "log client operations to stderr")
+	runCmd := cmd.setup(fs)
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+	out, err := newPrinter(*output, stdout)
+	if err != nil {
+		fmt.Fprintf(stderr, "rsw: %v\n", err)
+		return 2
+	}
+	// the client logs every operation, which is noise on a terminal unless asked for
+	log.SetOutput(io.Discard)
+	if *verbose {
+		log.SetOutput(stderr)
+	}
+	// every run uses the same consumer, a name per process would leave a dead consumer in the group on each run
+	if *consumer == "" {
+		*consumer = defaultConsumerName()
+	}
+	client := rediswrapper.NewRedisClientWrapper(rediswrapper.RedisClientConfig{
+		Addr:         *addr,
+		Username:     *username,
+		Password:     *password,
+		DB:           *db,
+		ConsumerName: *consumer,
+	})
+	defer client.CloseConnection()
+	err = runCmd(ctx, &env{client: client, out: out, stdin: stdin, stdout: stdout, args: fs.Args()})
+	if flushErr := out.flush(); err == nil {
+		err = flushErr
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "rsw %s: %v\n", cmd.name, err)
+		return 1
+	}
+	return 0
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: rsw <command> [flags]")
+	fmt.Fprintln(w, "\ncommands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(w, "  %-9s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(w, "\nrun rsw <command> -h for the flags of a command")
+}
+
+// defaultConsumerName is the consumer rsw reads and claims as on this host when -consumer is not given
+func defaultConsumerName() string {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "localhost"
+	}
+	return "rsw-" + hostname
+}
+
+func envOr(key string, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+// rsw runs the command line against the server and returns its exit code, stdout and stderr
+func rsw(t *testing.T, s *miniredis.Miniredis, stdin string, args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	args = append([]string{args[0], "-addr", s.Addr(), "-consumer", "rsw-test"}, args[1:]...)
+	code := run(context.Background(), args, strings.NewReader(stdin), &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func jsonLines(t *testing.T, output string) []map[string]interface{} {
+	records := make([]map[string]interface{}, 0)
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		if line == "" {
+			continue
+		}
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("Error decoding output line %q: %v", line, err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestProduceAndTail(t *testing.T) {
+	s := miniredis.RunT(t)
+	code, _, stderr := rsw(t, s, "", "produce", "-stream", "orders", "-field", "book=Dune", "-field", "qty=2")
+	assert.EqualValues(t, 0, code, stderr)
+	code, _, stderr = rsw(t, s, "", "produce", "-stream", "orders", "-json", `{"book":"Emma","id":12345678901234567890,"tags":["classic"]}`)
+	assert.EqualValues(t, 0, code, stderr)
+	code, stdout, stderr := rsw(t, s, "{\"book\":\"Ulysses\"}\n\n{\"book\":\"Beloved\"}\n", "produce", "-stream", "orders", "-output", "json")
+	assert.EqualValues(t, 0, code, stderr)
+	assert.EqualValues(t, 2, len(jsonLines(t, stdout)))
+
+	code, stdout, stderr = rsw(t, s, "", "tail", "-stream", "orders", "-from", "0", "-follow=false", "-output", "json")
+	assert.EqualValues(t, 0, code, stderr)
+	records := jsonLines(t, stdout)
+	assert.EqualValues(t, 4, len(records))
+	assert.EqualValues(t, map[string]interface{}{"book": "Dune", "qty": "2"}, records[0]["fields"])
+	assert.EqualValues(t, map[string]interface{}{"book": "Emma", "id": "12345678901234567890", "tags": `["classic"]`}, records[1]["fields"])
+
+	code, stdout, stderr = rsw(t, s, "", "tail", "-stream", "orders", "-from", "0", "-follow=false")
+	assert.EqualValues(t, 0, code, stderr)
+	lines := strings.Split(strings.TrimSpace(stdout), "\n")
+	assert.EqualValues(t, 5, len(lines))
+	assert.True(t, strings.HasPrefix(lines[0], "ID"))
+	assert.Contains(t, lines[1], "book=Dune qty=2")
+
+	code, _, stderr = rsw(t, s, "", "produce", "-stream", "payments", "-field", "amount=10")
+	assert.EqualValues(t, 0, code, stderr)
+	code, stdout, stderr = rsw(t, s, "", "tail", "-stream", "orders,payments", "-from", "0", "-follow=false", "-output", "json")
+	assert.EqualValues(t, 0, code, stderr)
+	assert.EqualValues(t, 5, len(jsonLines(t, stdout)))
+}
+
+func TestConsumePendingClaimAck(t *testing.T) {
+	s := miniredis.RunT(t)
+	code, _, stderr := rsw(t, s, "{\"n\":1}\n{\"n\":2}\n", "produce", "-stream", "orders")
+	assert.EqualValues(t, 0, code, stderr)
+
+	code, stdout, stderr := rsw(t, s, "", "consume", "-stream", "orders", "-group", "billing", "-output", "json")
+	assert.EqualValues(t, 0, code, stderr)
+	consumed := jsonLines(t, stdout)
+	assert.EqualValues(t, 2, len(consumed))
+	assert.EqualValues(t, "billing", consumed[0]["group"])
+
+	code, stdout, stderr = rsw(t, s, "", "pending", "-stream", "orders", "-group", "billing", "-output", "json")
+	assert.EqualValues(t, 0, code, stderr)
+	pending := jsonLines(t, stdout)
+	assert.EqualValues(t, 2, len(pending))
+	assert.EqualValues(t, "rsw-test", pending[0]["consumer"])
+
+	id := consumed[0]["id"].(string)
+	var out, errOut bytes.Buffer
+	code = run(context.Background(), []string{"claim", "-addr", s.Addr(), "-consumer", "other", "-stream", "orders", "-group", "billing", "-output", "json", id},
+		strings.NewReader(""), &out, &errOut)
+	assert.EqualValues(t, 0, code, errOut.String())
+	claimed := jsonLines(t, out.String())
+	assert.EqualValues(t, id, claimed[0]["id"])
+	assert.EqualValues(t, "other", claimed[0]["consumer"])
+
+	code, stdout, stderr = rsw(t, s, "", "pending", "-stream", "orders", "-group", "billing", "-owner", "other", "-output", "json")
+	assert.EqualValues(t, 0, code, stderr)
+	assert.EqualValues(t, 1, len(jsonLines(t, stdout)))
+
+	code, stdout, stderr = rsw(t, s, "", "dlq", "-stream", "orders", "-group", "billing", "-dlq", "orders-dlq", "-output", "json", id)
+	assert.EqualValues(t, 0, code, stderr)
+	assert.EqualValues(t, id, jsonLines(t, stdout)[0]["id"])
+	code, stdout, stderr = rsw(t, s, "", "ack", "-stream", "orders", "-group", "billing", "-output", "json", id, consumed[1]["id"].(string))
+	assert.EqualValues(t, 0, code, stderr)
+	assert.EqualValues(t, 1, jsonLines(t, stdout)[0]["acked"])
+	code, stdout, stderr = rsw(t, s, "", "groups", "-stream", "orders", "-output", "json")
+	assert.EqualValues(t, 0, code, stderr)
+	groups := jsonLines(t, stdout)
+	assert.EqualValues(t, "billing", groups[0]["name"])
+	assert.EqualValues(t, 0, groups[0]["pending"])
+}
+
+func TestUsageErrors(t *testing.T) {
+	s := miniredis.RunT(t)
+	code, _, stderr := rsw(t, s, "", "produce", "-field", "a=b")
+	assert.EqualValues(t, 1, code)
+	assert.Contains(t, stderr, "-stream is required")
+	code, _, stderr = rsw(t, s, "", "produce", "-stream", "orders", "-field", "novalue")
+	assert.EqualValues(t, 2, code)
+	assert.Contains(t, stderr, "must be key=value")
+	code, _, _ = rsw(t, s, "", "groups", "-stream", "orders", "-output", "xml")
+	assert.EqualValues(t, 2, code)
+	var stdout, errOut bytes.Buffer
+	code = run(context.Background(), []string{"nope"}, strings.NewReader(""), &stdout, &errOut)
+	assert.EqualValues(t, 2, code)
+	assert.Contains(t, errOut.String(), "unknown command")
+}
+
+func TestExportImport(t *testing.T) {
+	s := miniredis.RunT(t)
+	code, _, stderr := rsw(t, s, "{\"n\":1}\n{\"n\":2}\n{\"n\":3}\n", "produce", "-stream", "orders")
+	assert.EqualValues(t, 0, code, stderr)
+	code, exported, stderr := rsw(t, s, "", "export", "-stream", "orders", "-since", "1h")
+	assert.EqualValues(t, 0, code, stderr)
+	entries := jsonLines(t, exported)
+	assert.EqualValues(t, 3, len(entries))
+	assert.EqualValues(t, map[string]interface{}{"n": "1"}, entries[0]["fields"])
+
+	code, stdout, stderr := rsw(t, s, exported, "import", "-stream", "orders-copy", "-preserve-ids", "-output", "json")
+	assert.EqualValues(t, 0, code, stderr)
+	assert.EqualValues(t, 3, jsonLines(t, stdout)[0]["imported"])
+	code, copied, stderr := rsw(t, s, "", "export", "-stream", "orders-copy")
+	assert.EqualValues(t, 0, code, stderr)
+	assert.EqualValues(t, exported, copied)
+
+	code, _, stderr = rsw(t, s, "", "export", "-stream", "orders", "-until", "yesterday")
+	assert.EqualValues(t, 1, code)
+	assert.Contains(t, stderr, "invalid -until")
+}
+
+func TestMoveDryRun(t *testing.T) {
+	s := miniredis.RunT(t)
+	code, _, stderr := rsw(t, s, "{\"n\":1}\n{\"n\":2}\n{\"n\":3}\n", "produce", "-stream", "orders")
+	assert.EqualValues(t, 0, code, stderr)
+	code, _, stderr = rsw(t, s, "", "consume", "-stream", "orders", "-group", "billing", "-count", "1")
+	assert.EqualValues(t, 0, code, stderr)
+	code, stdout, stderr := rsw(t, s, "", "move", "-stream", "orders", "-group", "billing", "-to-end", "-dry-run", "-output", "json")
+	assert.EqualValues(t, 0, code, stderr)
+	move := jsonLines(t, stdout)[0]
+	assert.EqualValues(t, 2, move["skipped"])
+	assert.EqualValues(t, true, move["dry_run"])
+	code, _, stderr = rsw(t, s, "", "move", "-stream", "orders", "-group", "billing", "-to-end", "-to-id", "0")
+	assert.EqualValues(t, 1, code)
+	assert.Contains(t, stderr, "exactly one")
+}
+
+func TestRunsShareTheDefaultConsumer(t *testing.T) {
+	s := miniredis.RunT(t)
+	code, _, stderr := rsw(t, s, "{\"n\":1}\n{\"n\":2}\n", "produce", "-stream", "orders")
+	assert.EqualValues(t, 0, code, stderr)
+	for i := 0; i < 2; i++ {
+		var stdout, errOut bytes.Buffer
+		code = run(context.Background(), []string{"consume", "-addr", s.Addr(), "-stream", "orders", "-group", "billing", "-count", "1"},
+			strings.NewReader(""), &stdout, &errOut)
+		assert.EqualValues(t, 0, code, errOut.String())
+	}
+	code, stdout, stderr := rsw(t, s, "", "groups", "-stream", "orders", "-output", "json")
+	assert.EqualValues(t, 0, code, stderr)
+	assert.EqualValues(t, 1, jsonLines(t, stdout)[0]["consumers"])
+	code, stdout, stderr = rsw(t, s, "", "pending", "-stream", "orders", "-group", "billing", "-output", "json")
+	assert.EqualValues(t, 0, code, stderr)
+	pending := jsonLines(t, stdout)
+	assert.EqualValues(t, 2, len(pending))
+	assert.EqualValues(t, defaultConsumerName(), pending[0]["consumer"])
+}
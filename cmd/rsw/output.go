@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	rediswrapper "github.com/a-agmon/redis-streams-wrapper/v1"
+)
+
+// printer writes records either as an aligned table or as JSON lines, one object per record
+type printer struct {
+	json          bool
+	w             io.Writer
+	table         *tabwriter.Writer
+	headerWritten bool
+}
+
+func newPrinter(format string, w io.Writer) (*printer, error) {
+	switch format {
+	case "table":
+		return &printer{w: w, table: tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)}, nil
+	case "json":
+		return &printer{json: true, w: w}, nil
+	default:
+		return nil, fmt.Errorf("unknown output format %q, use table or json", format)
+	}
+}
+
+// print writes a record, header is written once before the first table row
+func (p *printer) print(record interface{}, header []string, cells []string) error {
+	if p.json {
+		return json.NewEncoder(p.w).Encode(record)
+	}
+	if !p.headerWritten {
+		p.headerWritten = true
+		if _, err := fmt.Fprintln(p.table, strings.Join(header, "\t")); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintln(p.table, strings.Join(cells, "\t"))
+	return err
+}
+
+// flush writes the buffered table rows, call it after every batch when following a stream
+func (p *printer) flush() error {
+	if p.table == nil {
+		return nil
+	}
+	return p.table.Flush()
+}
+
+type messageRecord struct {
+	ID       string                 `json:"id"`
+	Stream   string                 `json:"stream"`
+	Group    string                 `json:"group,omitempty"`
+	Consumer string                 `json:"consumer,omitempty"`
+	Fields   map[string]interface{} `json:"fields"`
+}
+
+func (p *printer) messages(messages []rediswrapper.RedisStreamsMessage) error {
+	for _, message := range messages {
+		record := messageRecord{
+			ID:       message.ID,
+			Stream:   message.StreamName,
+			Group:    message.ConsumerGroup,
+			Consumer: message.ConsumerName,
+			Fields:   message.Properties,
+		}
+		err := p.print(record, []string{"ID", "STREAM", "FIELDS"}, []string{message.ID, message.StreamName, formatFields(message.Properties)})
+		if err != nil {
+			return err
+		}
+	}
+	return p.flush()
+}
+
+type idRecord struct {
+	ID     string `json:"id"`
+	Stream string `json:"stream"`
+}
+
+func (p *printer) ids(stream string, ids []string) error {
+	for _, id := range ids {
+		if err := p.print(idRecord{ID: id, Stream: stream}, []string{"ID", "STREAM"}, []string{id, stream}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type pendingRecord struct {
+	ID            string    `json:"id"`
+	Consumer      string    `json:"consumer"`
+	DeliveryTime  time.Time `json:"delivery_time"`
+	DeliveryCount int64     `json:"delivery_count"`
+}
+
+func (p *printer) pending(entries []rediswrapper.PendingEntryInfo) error {
+	for _, entry := range entries {
+		record := pendingRecord{
+			ID:            entry.ID,
+			Consumer:      entry.Consumer,
+			DeliveryTime:  entry.DeliveryTime,
+			DeliveryCount: entry.DeliveryCount,
+		}
+		err := p.print(record, []string{"ID", "CONSUMER", "IDLE", "DELIVERIES"}, []string{
+			entry.ID,
+			entry.Consumer,
+			time.Since(entry.DeliveryTime).Truncate(time.Millisecond).String(),
+			fmt.Sprint(entry.DeliveryCount),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type groupRecord struct {
+	Name            string `json:"name"`
+	Consumers       int64  `json:"consumers"`
+	Pending         int64  `json:"pending"`
+	LastDeliveredID string `json:"last_delivered_id"`
+	Lag             int64  `json:"lag"`
+}
+
+func (p *printer) groups(groups []rediswrapper.GroupInfo) error {
+	for _, group := range groups {
+		record := groupRecord{
+			Name:            group.Name,
+			Consumers:       group.Consumers,
+			Pending:         group.Pending,
+			LastDeliveredID: group.LastDeliveredID,
+			Lag:             group.Lag,
+		}
+		err := p.print(record, []string{"GROUP", "CONSUMERS", "PENDING", "LAST DELIVERED", "LAG"}, []string{
+			group.Name,
+			fmt.Sprint(group.Consumers),
+			fmt.Sprint(group.Pending),
+			group.LastDeliveredID,
+			fmt.Sprint(group.Lag),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// formatFields renders message fields as sorted key=value pairs
+func formatFields(fields map[string]interface{}) string {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, fmt.Sprintf("%s=%v", key, fields[key]))
+	}
+	return strings.Join(pairs, " ")
+}
@@ -1,21 +1,39 @@
 package generate
 
 import (
+	crand "crypto/rand"
+	"encoding/binary"
 	"fmt"
 	"math/rand"
+	"sync"
 	"time"
 )
 
+// the source is seeded once from crypto/rand so that processes starting at the same instant don't share a sequence
+var (
+	randMu  sync.Mutex
+	randGen = rand.New(rand.NewSource(cryptoSeed()))
+)
+
+func cryptoSeed() int64 {
+	var b [8]byte
+	if _, err := crand.Read(b[:]); err != nil {
+		return time.Now().UnixNano()
+	}
+	return int64(binary.LittleEndian.Uint64(b[:]))
+}
+
 func RandomStringWithPrefix(prefix string) string {
-	rand.Seed(time.Now().UnixNano())
+	randMu.Lock()
 	// Generate three random uppercase letters
 	b := make([]byte, 3)
 	for i := range b {
-		b[i] = byte(rand.Intn(26) + 'A')
+		b[i] = byte(randGen.Intn(26) + 'A')
 	}
 	randomLetters := string(b)
-	// Generate three random digits
-	randomDigits := fmt.Sprintf("%05d", rand.Intn(1000))
+	// Generate five random digits
+	randomDigits := fmt.Sprintf("%05d", randGen.Intn(100000))
+	randMu.Unlock()
 	// Generate the date as yyyy-MM-dd-hhmm
 	date := time.Now().Format("2006-01-02-1504")
 	// Concatenate the parts to form the final random string
@@ -0,0 +1,99 @@
+package generate
+
+import (
+	crand "crypto/rand"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// crockford base32 alphabet used by ULIDs
+const ulidAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// ULID returns a new ULID: a 48 bit millisecond timestamp followed by 80 bits from crypto/rand,
+// encoded as 26 characters of Crockford base32. ULIDs sort by creation time
+func ULID() (string, error) {
+	var b [16]byte
+	ms := uint64(time.Now().UnixMilli())
+	for i := 5; i >= 0; i-- {
+		b[i] = byte(ms)
+		ms >>= 8
+	}
+	if _, err := crand.Read(b[6:]); err != nil {
+		return "", fmt.Errorf("error reading random bytes: %v", err)
+	}
+	// 128 bits are encoded as 26 groups of 5 bits, the first group only holds 3 bits
+	out := make([]byte, 26)
+	for i := 25; i >= 0; i-- {
+		out[i] = ulidAlphabet[b[15]&0x1f]
+		// shift the whole 128 bit value right by 5
+		var carry byte
+		for j := 0; j < 16; j++ {
+			next := b[j] & 0x1f
+			b[j] = b[j]>>5 | carry<<3
+			carry = next
+		}
+	}
+	return string(out), nil
+}
+
+// ULIDWithPrefix returns prefix-<ULID>
+func ULIDWithPrefix(prefix string) (string, error) {
+	id, err := ULID()
+	if err != nil {
+		return "", err
+	}
+	return prefix + "-" + id, nil
+}
+
+// HostnamePIDWithPrefix returns prefix-<hostname>-<pid>, which is unique per running process on a host
+func HostnamePIDWithPrefix(prefix string) (string, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return "", fmt.Errorf("error reading hostname: %v", err)
+	}
+	return fmt.Sprintf("%s-%s-%d", prefix, hostname, os.Getpid()), nil
+}
+
+// PodNameWithPrefix returns prefix-<pod name>, reading the pod name from the given environment variable
+// (usually populated with the Kubernetes downward API). If envVar is empty POD_NAME is used
+func PodNameWithPrefix(prefix string, envVar string) (string, error) {
+	if envVar == "" {
+		envVar = "POD_NAME"
+	}
+	podName := strings.TrimSpace(os.Getenv(envVar))
+	if podName == "" {
+		return "", fmt.Errorf("environment variable %s is not set", envVar)
+	}
+	return prefix + "-" + podName, nil
+}
+
+// PersistedWithPrefix returns the name stored in the given file, so a process keeps the same name across restarts.
+// If the file does not exist a new prefix-<ULID> name is generated and written to it
+func PersistedWithPrefix(prefix string, path string) (string, error) {
+	if path == "" {
+		return "", fmt.Errorf("path of the persisted name cannot be empty")
+	}
+	content, err := os.ReadFile(path)
+	if err == nil {
+		name := strings.TrimSpace(string(content))
+		if name != "" {
+			return name, nil
+		}
+	} else if !os.IsNotExist(err) {
+		return "", fmt.Errorf("error reading persisted name from %s: %v", path, err)
+	}
+	name, err := ULIDWithPrefix(prefix)
+	if err != nil {
+		return "", err
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", fmt.Errorf("error creating directory for %s: %v", path, err)
+	}
+	if err = os.WriteFile(path, []byte(name+"\n"), 0o644); err != nil {
+		return "", fmt.Errorf("error persisting name to %s: %v", path, err)
+	}
+	return name, nil
+}
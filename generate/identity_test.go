@@ -0,0 +1,70 @@
+package generate
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var ulidPattern = regexp.MustCompile(`^[0-9A-HJKMNP-TV-Z]{26}$`)
+
+func TestULID(t *testing.T) {
+	seen := make(map[string]bool)
+	previous := ""
+	for i := 0; i < 1000; i++ {
+		id, err := ULID()
+		if err != nil {
+			t.Fatalf("Error generating ULID: %v", err)
+		}
+		assert.Regexp(t, ulidPattern, id)
+		assert.False(t, seen[id])
+		seen[id] = true
+		// the timestamp part sorts by creation time
+		if previous != "" {
+			assert.True(t, id[:10] >= previous[:10])
+		}
+		previous = id
+	}
+}
+
+func TestULIDTimestamp(t *testing.T) {
+	before := time.Now().UnixMilli()
+	id, err := ULID()
+	if err != nil {
+		t.Fatalf("Error generating ULID: %v", err)
+	}
+	var ms int64
+	for _, c := range id[:10] {
+		ms = ms<<5 | int64(strings.IndexRune(ulidAlphabet, c))
+	}
+	assert.True(t, ms >= before && ms <= time.Now().UnixMilli())
+}
+
+func TestPodNameWithPrefix(t *testing.T) {
+	t.Setenv("TEST_POD_NAME", "orders-7d9f-abcde")
+	name, err := PodNameWithPrefix("consumer", "TEST_POD_NAME")
+	if err != nil {
+		t.Fatalf("Error generating pod name: %v", err)
+	}
+	assert.EqualValues(t, "consumer-orders-7d9f-abcde", name)
+	_, err = PodNameWithPrefix("consumer", "TEST_POD_NAME_MISSING")
+	assert.Error(t, err)
+}
+
+func TestPersistedWithPrefix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "consumer-name")
+	first, err := PersistedWithPrefix("consumer", path)
+	if err != nil {
+		t.Fatalf("Error generating persisted name: %v", err)
+	}
+	assert.True(t, strings.HasPrefix(first, "consumer-"))
+	second, err := PersistedWithPrefix("consumer", path)
+	if err != nil {
+		t.Fatalf("Error reading persisted name: %v", err)
+	}
+	assert.EqualValues(t, first, second)
+}
@@ -0,0 +1,180 @@
+// Package metrics exposes Prometheus metrics for the redis streams wrapper.
+// A Collector is both a rediswrapper.Observer, to be set on RedisClientConfig.Observer, and a prometheus.Collector
+package metrics
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	rediswrapper "github.com/a-agmon/redis-streams-wrapper/v1"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// CollectorOpts configures the metric names and buckets of a Collector
+type CollectorOpts struct {
+	// Namespace prefixes all metric names, redis_streams by default
+	Namespace string
+	// DurationBuckets are the buckets of the latency histograms, prometheus.DefBuckets by default
+	DurationBuckets []float64
+	// BatchSizeBuckets are the buckets of the batch size histogram
+	BatchSizeBuckets []float64
+	// LagTimeout bounds the time spent measuring lag during a scrape, 5 seconds by default
+	LagTimeout time.Duration
+}
+
+// Collector records client operations and handler results, and measures pending and lag gauges of tracked streams on every scrape
+type Collector struct {
+	operations        *prometheus.CounterVec
+	operationDuration *prometheus.HistogramVec
+	batchSize         *prometheus.HistogramVec
+	handlerDuration   *prometheus.HistogramVec
+	handlerErrors     *prometheus.CounterVec
+
+	pendingDesc    *prometheus.Desc
+	lagEntriesDesc *prometheus.Desc
+	lagSecondsDesc *prometheus.Desc
+	lagTimeout     time.Duration
+
+	mu          sync.Mutex
+	lagWatchers []*rediswrapper.LagWatcher
+}
+
+var _ rediswrapper.Observer = (*Collector)(nil)
+var _ prometheus.Collector = (*Collector)(nil)
+
+// NewCollector creates a Collector, register it with prometheus.MustRegister and set it as the client's observer
+func NewCollector(opts CollectorOpts) *Collector {
+	if opts.Namespace == "" {
+		opts.Namespace = "redis_streams"
+	}
+	if opts.DurationBuckets == nil {
+		opts.DurationBuckets = prometheus.DefBuckets
+	}
+	if opts.BatchSizeBuckets == nil {
+		opts.BatchSizeBuckets = []float64{0, 1, 5, 10, 25, 50, 100, 250, 500, 1000}
+	}
+	if opts.LagTimeout <= 0 {
+		opts.LagTimeout = 5 * time.Second
+	}
+	groupLabels := []string{"stream", "group"}
+	return &Collector{
+		operations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: opts.Namespace,
+			Name:      "operations_total",
+			Help:      "Number of produce, fetch, ack and claim calls by result.",
+		}, []string{"operation", "stream", "group", "result"}),
+		operationDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: opts.Namespace,
+			Name:      "operation_duration_seconds",
+			Help:      "Latency of produce, fetch, ack and claim calls, including the block time of fetches.",
+			Buckets:   opts.DurationBuckets,
+		}, []string{"operation", "stream", "group"}),
+		batchSize: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: opts.Namespace,
+			Name:      "batch_size",
+			Help:      "Number of messages produced, fetched, acked or claimed per call.",
+			Buckets:   opts.BatchSizeBuckets,
+		}, []string{"operation", "stream", "group"}),
+		handlerDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: opts.Namespace,
+			Name:      "handler_duration_seconds",
+			Help:      "Time spent in subscription handlers.",
+			Buckets:   opts.DurationBuckets,
+		}, groupLabels),
+		handlerErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: opts.Namespace,
+			Name:      "handler_errors_total",
+			Help:      "Number of messages whose subscription handler returned an error.",
+		}, groupLabels),
+		pendingDesc: prometheus.NewDesc(prometheus.BuildFQName(opts.Namespace, "", "group_pending"),
+			"Number of messages delivered to the group but not yet acked.", groupLabels, nil),
+		lagEntriesDesc: prometheus.NewDesc(prometheus.BuildFQName(opts.Namespace, "", "group_lag_entries"),
+			"Number of stream entries not yet delivered to the group.", groupLabels, nil),
+		lagSecondsDesc: prometheus.NewDesc(prometheus.BuildFQName(opts.Namespace, "", "group_lag_seconds"),
+			"Age of the oldest stream entry not yet delivered to the group.", groupLabels, nil),
+		lagTimeout: opts.LagTimeout,
+	}
+}
+
+// TrackLag adds pending and lag gauges for every consumer group of the given streams, measured with client on each scrape.
+// Each measure costs a few commands per group, see rediswrapper.RedisStreamsClient.Lag for when the entries gauge is capped.
+// A stream tracked more than once, e.g. with two clients, is reported once
+func (c *Collector) TrackLag(client *rediswrapper.RedisStreamsClient, streams ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lagWatchers = append(c.lagWatchers, client.WatchLag(rediswrapper.LagWatcherConfig{Streams: streams}))
+}
+
+// ObserveOperation implements rediswrapper.Observer
+func (c *Collector) ObserveOperation(operation string, stream string, group string, count int, duration time.Duration, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	c.operations.WithLabelValues(operation, stream, group, result).Inc()
+	c.operationDuration.WithLabelValues(operation, stream, group).Observe(duration.Seconds())
+	if err == nil {
+		c.batchSize.WithLabelValues(operation, stream, group).Observe(float64(count))
+	}
+}
+
+// ObserveHandler implements rediswrapper.Observer
+func (c *Collector) ObserveHandler(stream string, group string, duration time.Duration, err error) {
+	c.handlerDuration.WithLabelValues(stream, group).Observe(duration.Seconds())
+	if err != nil {
+		c.handlerErrors.WithLabelValues(stream, group).Inc()
+	}
+}
+
+// Describe implements prometheus.Collector
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	c.operations.Describe(ch)
+	c.operationDuration.Describe(ch)
+	c.batchSize.Describe(ch)
+	c.handlerDuration.Describe(ch)
+	c.handlerErrors.Describe(ch)
+	ch <- c.pendingDesc
+	ch <- c.lagEntriesDesc
+	ch <- c.lagSecondsDesc
+}
+
+// Collect implements prometheus.Collector
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.operations.Collect(ch)
+	c.operationDuration.Collect(ch)
+	c.batchSize.Collect(ch)
+	c.handlerDuration.Collect(ch)
+	c.handlerErrors.Collect(ch)
+	c.collectLag(ch)
+}
+
+func (c *Collector) collectLag(ch chan<- prometheus.Metric) {
+	c.mu.Lock()
+	watchers := append([]*rediswrapper.LagWatcher(nil), c.lagWatchers...)
+	c.mu.Unlock()
+	if len(watchers) == 0 {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), c.lagTimeout)
+	defer cancel()
+	// the same labels collected twice would make the whole gather fail
+	collected := make(map[[2]string]struct{})
+	for _, watcher := range watchers {
+		lags, err := watcher.Check(ctx)
+		if err != nil {
+			log.Printf("Error measuring lag for metrics: %v\n", err)
+		}
+		for _, lag := range lags {
+			key := [2]string{lag.StreamName, lag.ConsumerGroup}
+			if _, ok := collected[key]; ok {
+				continue
+			}
+			collected[key] = struct{}{}
+			ch <- prometheus.MustNewConstMetric(c.pendingDesc, prometheus.GaugeValue, float64(lag.Pending), lag.StreamName, lag.ConsumerGroup)
+			ch <- prometheus.MustNewConstMetric(c.lagEntriesDesc, prometheus.GaugeValue, float64(lag.EntriesBehind), lag.StreamName, lag.ConsumerGroup)
+			ch <- prometheus.MustNewConstMetric(c.lagSecondsDesc, prometheus.GaugeValue, lag.TimeBehind.Seconds(), lag.StreamName, lag.ConsumerGroup)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	rediswrapper "github.com/a-agmon/redis-streams-wrapper/v1"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCollectorRecordsClientOperations(t *testing.T) {
+	s := miniredis.RunT(t)
+	collector := NewCollector(CollectorOpts{})
+	client := rediswrapper.NewRedisClientWrapper(rediswrapper.RedisClientConfig{
+		Addr:         s.Addr(),
+		ConsumerName: "metrics-consumer",
+		Observer:     collector,
+	})
+	defer client.CloseConnection()
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		err := client.ProduceMessage(ctx, "orders", map[string]interface{}{"index": i})
+		if err != nil {
+			t.Fatalf("Error producing message: %v", err)
+		}
+	}
+	messages, err := client.FetchNewMessages(ctx, "orders", "billing", 10, 1)
+	if err != nil {
+		t.Fatalf("Error polling for new messages: %v", err)
+	}
+	err = client.AckMessage(ctx, "orders", "billing", messages[0].ID)
+	if err != nil {
+		t.Fatalf("Error acking message: %v", err)
+	}
+	collector.ObserveHandler("orders", "billing", time.Millisecond, errors.New("boom"))
+
+	assert.EqualValues(t, 3, testutil.ToFloat64(collector.operations.WithLabelValues(rediswrapper.OperationProduce, "orders", "", "success")))
+	assert.EqualValues(t, 1, testutil.ToFloat64(collector.operations.WithLabelValues(rediswrapper.OperationFetch, "orders", "billing", "success")))
+	assert.EqualValues(t, 1, testutil.ToFloat64(collector.operations.WithLabelValues(rediswrapper.OperationAck, "orders", "billing", "success")))
+	assert.EqualValues(t, 1, testutil.ToFloat64(collector.handlerErrors.WithLabelValues("orders", "billing")))
+
+	// two messages were fetched but not acked, nothing is left undelivered
+	collector.TrackLag(client, "orders")
+	expected := `
+# HELP redis_streams_group_lag_entries Number of stream entries not yet delivered to the group.
+# TYPE redis_streams_group_lag_entries gauge
+redis_streams_group_lag_entries{group="billing",stream="orders"} 0
+# HELP redis_streams_group_pending Number of messages delivered to the group but not yet acked.
+# TYPE redis_streams_group_pending gauge
+redis_streams_group_pending{group="billing",stream="orders"} 2
+`
+	err = testutil.CollectAndCompare(collector, strings.NewReader(expected),
+		"redis_streams_group_pending", "redis_streams_group_lag_entries")
+	assert.NoError(t, err)
+}
+
+func TestCollectorReportsStreamsTrackedTwiceOnce(t *testing.T) {
+	s := miniredis.RunT(t)
+	collector := NewCollector(CollectorOpts{})
+	first := rediswrapper.NewRedisClientWrapper(rediswrapper.RedisClientConfig{Addr: s.Addr(), ConsumerName: "metrics-first"})
+	defer first.CloseConnection()
+	second := rediswrapper.NewRedisClientWrapper(rediswrapper.RedisClientConfig{Addr: s.Addr(), ConsumerName: "metrics-second"})
+	defer second.CloseConnection()
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		err := first.ProduceMessage(ctx, "orders", map[string]interface{}{"index": i})
+		if err != nil {
+			t.Fatalf("Error producing message: %v", err)
+		}
+	}
+	_, err := first.FetchNewMessages(ctx, "orders", "billing", 1, 1)
+	if err != nil {
+		t.Fatalf("Error polling for new messages: %v", err)
+	}
+	collector.TrackLag(first, "orders")
+	collector.TrackLag(first, "orders")
+	collector.TrackLag(second, "orders")
+
+	registry := prometheus.NewPedanticRegistry()
+	registry.MustRegister(collector)
+	_, err = registry.Gather()
+	assert.NoError(t, err)
+	expected := `
+# HELP redis_streams_group_lag_entries Number of stream entries not yet delivered to the group.
+# TYPE redis_streams_group_lag_entries gauge
+redis_streams_group_lag_entries{group="billing",stream="orders"} 2
+`
+	err = testutil.CollectAndCompare(collector, strings.NewReader(expected), "redis_streams_group_lag_entries")
+	assert.NoError(t, err)
+}
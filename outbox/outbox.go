@@ -0,0 +1,359 @@
+// Package outbox relays events from a transactional outbox table to redis streams.
+// Applications insert events into the outbox table in the same database transaction as their own writes,
+// and a Relay polls the table through database/sql, produces every row to its stream and marks it sent.
+//
+// The outbox table must have the following columns (names are fixed, the table name is configurable):
+//
+//	CREATE TABLE outbox (
+//		id           BIGINT PRIMARY KEY, -- auto incremented, rows are relayed in id order
+//		stream       VARCHAR(255) NOT NULL,
+//		payload      TEXT NOT NULL,      -- a JSON object of scalar values, produced as the message fields
+//		sent_at      BIGINT NULL,        -- unix milliseconds, set once the row was produced
+//		locked_by    VARCHAR(255) NULL,
+//		locked_until BIGINT NULL,        -- unix milliseconds
+//		attempts     INT NOT NULL DEFAULT 0,
+//		last_error   TEXT NULL
+//	)
+//
+// A row that can't be relayed doesn't hold back the rows after it: its attempts are counted, its last error is
+// recorded and it is retried after RetryDelay. A row whose payload can't be decoded, or that failed MaxAttempts
+// times, is parked: it is never selected again, until an operator fixes it and resets attempts to 0.
+//
+// Several relay replicas may run against the same table: every replica locks the rows it relays by setting
+// locked_by and locked_until with a conditional UPDATE, which works on any SQL database. A row locked by a replica
+// that died is picked up by another one once the lock expires, and since rows are produced with their ID as dedup key
+// a row produced just before the crash is not produced twice
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	rediswrapper "github.com/a-agmon/redis-streams-wrapper/v1"
+)
+
+// Placeholder is the bind parameter style of the database driver
+type Placeholder int
+
+const (
+	// QuestionPlaceholders uses ? for parameters, as SQLite and MySQL do
+	QuestionPlaceholders Placeholder = iota
+	// DollarPlaceholders uses $1, $2... for parameters, as PostgreSQL does
+	DollarPlaceholders
+)
+
+// Config configures a Relay
+type Config struct {
+	// Table is the name of the outbox table, outbox by default
+	Table string
+	// Placeholder is the parameter style of the driver, QuestionPlaceholders by default
+	Placeholder Placeholder
+	// BatchSize is the maximum number of rows relayed per poll, 100 by default
+	BatchSize int
+	// PollInterval is how long Run waits after a poll that found no rows, 1 second by default
+	PollInterval time.Duration
+	// LockTimeout is how long a replica owns the rows it locked, 30 seconds by default
+	LockTimeout time.Duration
+	// DedupTTL is how long a produced row is remembered to avoid producing it twice, 24 hours by default
+	DedupTTL time.Duration
+	// RelayID identifies the replica in locked_by, the client's consumer name by default
+	RelayID string
+	// DeleteSent deletes rows once they were produced instead of setting sent_at
+	DeleteSent bool
+	// MaxAttempts is the number of failed relays after which a row is parked, 10 by default
+	MaxAttempts int
+	// RetryDelay is how long a row that failed to be relayed waits before it is retried, 30 seconds by default
+	RetryDelay time.Duration
+}
+
+// Execer is implemented by *sql.DB and *sql.Tx, so events can be enqueued in the caller's transaction
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+// Relay polls an outbox table and produces its rows to redis streams
+type Relay struct {
+	db     *sql.DB
+	client *rediswrapper.RedisStreamsClient
+	config Config
+}
+
+// row is an outbox row locked by this relay
+type row struct {
+	id      int64
+	stream  string
+	payload string
+}
+
+// NewRelay creates a Relay, call Run to start relaying
+// it requires the following parameters:
+// db: the database holding the outbox table
+// client: the client used to produce the rows
+// config: the table and polling settings of the relay
+func NewRelay(db *sql.DB, client *rediswrapper.RedisStreamsClient, config Config) *Relay {
+	if config.Table == "" {
+		config.Table = "outbox"
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = 100
+	}
+	if config.PollInterval <= 0 {
+		config.PollInterval = time.Second
+	}
+	if config.LockTimeout <= 0 {
+		config.LockTimeout = 30 * time.Second
+	}
+	if config.DedupTTL <= 0 {
+		config.DedupTTL = 24 * time.Hour
+	}
+	if config.RelayID == "" {
+		config.RelayID = client.Config.ConsumerName
+	}
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = 10
+	}
+	if config.RetryDelay <= 0 {
+		config.RetryDelay = 30 * time.Second
+	}
+	return &Relay{db: db, client: client, config: config}
+}
+
+// Enqueue inserts an event into the outbox table, pass the transaction of the writes the event belongs to
+// it requires the following parameters:
+// tx: the transaction (or database) to insert with
+// streamKey: the stream the event is produced to
+// payload: the fields of the message, its values must be strings, numbers or booleans
+func (r *Relay) Enqueue(ctx context.Context, tx Execer, streamKey string, payload map[string]interface{}) error {
+	if err := validatePayload(payload); err != nil {
+		return fmt.Errorf("invalid outbox payload: %v", err)
+	}
+	encoded, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("error encoding outbox payload: %v", err)
+	}
+	_, err = tx.ExecContext(ctx, r.query("INSERT INTO %s (stream, payload) VALUES (?, ?)"), streamKey, string(encoded))
+	if err != nil {
+		return fmt.Errorf("error inserting outbox row: %v", err)
+	}
+	return nil
+}
+
+// Run relays rows until the context is cancelled, in which case it returns nil.
+// Errors are logged and retried on the next poll
+func (r *Relay) Run(ctx context.Context) error {
+	for {
+		relayed, err := r.RelayOnce(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			log.Printf("Error relaying outbox table %s: %v\n", r.config.Table, err)
+		}
+		if relayed == r.config.BatchSize && err == nil {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(r.config.PollInterval):
+		}
+	}
+}
+
+// RelayOnce locks up to BatchSize unsent rows, produces them in id order and marks them sent.
+// A row that can't be produced is retried after RetryDelay, or parked, and the following rows are still relayed,
+// in which case the error lists the rows that failed. It returns the number of rows relayed
+func (r *Relay) RelayOnce(ctx context.Context) (int, error) {
+	rows, err := r.lock(ctx)
+	if err != nil {
+		return 0, err
+	}
+	relayed := 0
+	failures := make([]string, 0)
+	for _, row := range rows {
+		park, err := r.relay(ctx, row)
+		if err != nil {
+			if ctx.Err() != nil {
+				return relayed, err
+			}
+			failures = append(failures, err.Error())
+			if err = r.markFailed(ctx, row.id, err, park); err != nil {
+				failures = append(failures, err.Error())
+			}
+			continue
+		}
+		if err = r.markSent(ctx, row.id); err != nil {
+			return relayed, err
+		}
+		relayed++
+	}
+	if len(failures) > 0 {
+		return relayed, fmt.Errorf("error relaying outbox rows: %s", strings.Join(failures, "; "))
+	}
+	return relayed, nil
+}
+
+// relay produces a row, it reports whether the row should be parked right away because retrying can't help
+func (r *Relay) relay(ctx context.Context, row row) (bool, error) {
+	payload, err := decodePayload(row.payload)
+	if err != nil {
+		return true, fmt.Errorf("error decoding payload of outbox row %d: %v", row.id, err)
+	}
+	if err = validatePayload(payload); err != nil {
+		return true, fmt.Errorf("invalid payload in outbox row %d: %v", row.id, err)
+	}
+	dedupKey := r.config.Table + ":" + strconv.FormatInt(row.id, 10)
+	id, duplicate, err := r.client.ProduceMessageIdempotent(ctx, row.stream, dedupKey, payload, r.config.DedupTTL)
+	if err != nil {
+		return false, fmt.Errorf("error producing outbox row %d: %v", row.id, err)
+	}
+	if duplicate {
+		log.Printf("Outbox row %d was already produced as message %s\n", row.id, id)
+	}
+	return false, nil
+}
+
+// lock takes the lock of unsent rows that are not locked by another relay, and returns the rows this relay owns
+func (r *Relay) lock(ctx context.Context) ([]row, error) {
+	now := time.Now().UnixMilli()
+	candidates, err := r.db.QueryContext(ctx, r.query(
+		"SELECT id FROM %s WHERE sent_at IS NULL AND attempts < ? AND (locked_until IS NULL OR locked_until < ? OR locked_by = ?) ORDER BY id LIMIT ?"),
+		r.config.MaxAttempts, now, r.config.RelayID, r.config.BatchSize)
+	if err != nil {
+		return nil, fmt.Errorf("error selecting outbox rows: %v", err)
+	}
+	ids := make([]int64, 0, r.config.BatchSize)
+	for candidates.Next() {
+		var id int64
+		if err = candidates.Scan(&id); err != nil {
+			candidates.Close()
+			return nil, fmt.Errorf("error reading outbox row: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	candidates.Close()
+	if err = candidates.Err(); err != nil {
+		return nil, fmt.Errorf("error selecting outbox rows: %v", err)
+	}
+	// the UPDATE only succeeds if no other relay locked the row since it was selected
+	lockUntil := now + r.config.LockTimeout.Milliseconds()
+	locked := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		result, err := r.db.ExecContext(ctx, r.query(
+			"UPDATE %s SET locked_by = ?, locked_until = ? WHERE id = ? AND sent_at IS NULL AND attempts < ? AND (locked_until IS NULL OR locked_until < ? OR locked_by = ?)"),
+			r.config.RelayID, lockUntil, id, r.config.MaxAttempts, now, r.config.RelayID)
+		if err != nil {
+			return nil, fmt.Errorf("error locking outbox row %d: %v", id, err)
+		}
+		if affected, err := result.RowsAffected(); err == nil && affected == 1 {
+			locked = append(locked, id)
+		}
+	}
+	rows := make([]row, 0, len(locked))
+	for _, id := range locked {
+		var row row
+		err = r.db.QueryRowContext(ctx, r.query("SELECT id, stream, payload FROM %s WHERE id = ?"), id).Scan(&row.id, &row.stream, &row.payload)
+		if err != nil {
+			return nil, fmt.Errorf("error reading outbox row %d: %v", id, err)
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// markSent marks a row produced, or deletes it when DeleteSent is set
+func (r *Relay) markSent(ctx context.Context, id int64) error {
+	var err error
+	if r.config.DeleteSent {
+		_, err = r.db.ExecContext(ctx, r.query("DELETE FROM %s WHERE id = ? AND locked_by = ?"), id, r.config.RelayID)
+	} else {
+		_, err = r.db.ExecContext(ctx, r.query("UPDATE %s SET sent_at = ?, locked_by = NULL, locked_until = NULL WHERE id = ? AND locked_by = ?"),
+			time.Now().UnixMilli(), id, r.config.RelayID)
+	}
+	if err != nil {
+		return fmt.Errorf("error marking outbox row %d as sent: %v", id, err)
+	}
+	return nil
+}
+
+// markFailed records the error of a row and counts the attempt. The row is released until RetryDelay passed,
+// so it doesn't hold back the following rows, or parked for good
+func (r *Relay) markFailed(ctx context.Context, id int64, relayErr error, park bool) error {
+	var err error
+	if park {
+		_, err = r.db.ExecContext(ctx, r.query("UPDATE %s SET attempts = ?, last_error = ?, locked_by = NULL, locked_until = NULL WHERE id = ? AND locked_by = ?"),
+			r.config.MaxAttempts, relayErr.Error(), id, r.config.RelayID)
+	} else {
+		_, err = r.db.ExecContext(ctx, r.query("UPDATE %s SET attempts = attempts + 1, last_error = ?, locked_by = NULL, locked_until = ? WHERE id = ? AND locked_by = ?"),
+			relayErr.Error(), time.Now().Add(r.config.RetryDelay).UnixMilli(), id, r.config.RelayID)
+	}
+	if err != nil {
+		return fmt.Errorf("error recording failure of outbox row %d: %v", id, err)
+	}
+	if park {
+		log.Printf("Parked outbox row %d: %v\n", id, relayErr)
+	}
+	return nil
+}
+
+// decodePayload decodes the payload of a row keeping numbers as written, as float64 can't hold integers above 2^53.
+// Numbers are returned as strings, the form redis stores them in
+func decodePayload(encoded string) (map[string]interface{}, error) {
+	decoder := json.NewDecoder(strings.NewReader(encoded))
+	decoder.UseNumber()
+	var payload map[string]interface{}
+	if err := decoder.Decode(&payload); err != nil {
+		return nil, err
+	}
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, fmt.Errorf("unexpected data after the payload object")
+	}
+	for field, value := range payload {
+		if number, ok := value.(json.Number); ok {
+			payload[field] = number.String()
+		}
+	}
+	return payload, nil
+}
+
+// validatePayload checks a payload has fields and that every value is a scalar redis can store as a field
+func validatePayload(payload map[string]interface{}) error {
+	if len(payload) == 0 {
+		return fmt.Errorf("payload cannot be empty")
+	}
+	for field, value := range payload {
+		switch value.(type) {
+		case string, bool, json.Number,
+			int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		default:
+			return fmt.Errorf("field %s holds a %T, only strings, numbers and booleans can be produced", field, value)
+		}
+	}
+	return nil
+}
+
+// query sets the table name in a query written with ? placeholders, and rewrites them for the driver
+func (r *Relay) query(format string) string {
+	query := fmt.Sprintf(format, r.config.Table)
+	if r.config.Placeholder != DollarPlaceholders {
+		return query
+	}
+	var b strings.Builder
+	n := 0
+	for _, c := range query {
+		if c == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
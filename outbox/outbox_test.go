@@ -0,0 +1,306 @@
+package outbox
+
+import (
+	"context"
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+
+	rediswrapper "github.com/a-agmon/redis-streams-wrapper/v1"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+
+	_ "modernc.org/sqlite"
+)
+
+const schema = `CREATE TABLE outbox (
+	id           INTEGER PRIMARY KEY AUTOINCREMENT,
+	stream       TEXT NOT NULL,
+	payload      TEXT NOT NULL,
+	sent_at      BIGINT NULL,
+	locked_by    TEXT NULL,
+	locked_until BIGINT NULL,
+	attempts     INT NOT NULL DEFAULT 0,
+	last_error   TEXT NULL
+)`
+
+func newTestDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "outbox.db")+"?_pragma=busy_timeout(5000)")
+	if err != nil {
+		t.Fatalf("Error opening database: %v", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if _, err = db.Exec(schema); err != nil {
+		t.Fatalf("Error creating outbox table: %v", err)
+	}
+	return db
+}
+
+func newTestClient(t *testing.T, s *miniredis.Miniredis, consumerName string) *rediswrapper.RedisStreamsClient {
+	client := rediswrapper.NewRedisClientWrapper(rediswrapper.RedisClientConfig{Addr: s.Addr(), ConsumerName: consumerName})
+	t.Cleanup(client.CloseConnection)
+	return client
+}
+
+func enqueue(t *testing.T, relay *Relay, db *sql.DB, count int) {
+	ctx := context.Background()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatalf("Error starting transaction: %v", err)
+	}
+	for i := 0; i < count; i++ {
+		err = relay.Enqueue(ctx, tx, "orders", map[string]interface{}{"order": i, "status": "created"})
+		if err != nil {
+			t.Fatalf("Error enqueuing event: %v", err)
+		}
+	}
+	if err = tx.Commit(); err != nil {
+		t.Fatalf("Error committing transaction: %v", err)
+	}
+}
+
+func streamLength(t *testing.T, client *rediswrapper.RedisStreamsClient, stream string) int64 {
+	info, err := client.StreamInfo(context.Background(), stream)
+	if err != nil {
+		t.Fatalf("Error reading stream info: %v", err)
+	}
+	return info.Length
+}
+
+func TestRelayOnce(t *testing.T) {
+	s := miniredis.RunT(t)
+	db := newTestDB(t)
+	client := newTestClient(t, s, "relay-1")
+	relay := NewRelay(db, client, Config{})
+	enqueue(t, relay, db, 3)
+
+	relayed, err := relay.RelayOnce(context.Background())
+	if err != nil {
+		t.Fatalf("Error relaying: %v", err)
+	}
+	assert.EqualValues(t, 3, relayed)
+	assert.EqualValues(t, 3, streamLength(t, client, "orders"))
+	messages, err := client.FetchNewMessages(context.Background(), "orders", "billing", 10, 1)
+	if err != nil {
+		t.Fatalf("Error polling for new messages: %v", err)
+	}
+	assert.EqualValues(t, map[string]interface{}{"order": "0", "status": "created"}, messages[0].Properties)
+	var unsent int
+	err = db.QueryRow("SELECT COUNT(*) FROM outbox WHERE sent_at IS NULL").Scan(&unsent)
+	if err != nil {
+		t.Fatalf("Error counting rows: %v", err)
+	}
+	assert.EqualValues(t, 0, unsent)
+
+	relayed, err = relay.RelayOnce(context.Background())
+	if err != nil {
+		t.Fatalf("Error relaying: %v", err)
+	}
+	assert.EqualValues(t, 0, relayed)
+}
+
+func TestRelayDeleteSent(t *testing.T) {
+	s := miniredis.RunT(t)
+	db := newTestDB(t)
+	relay := NewRelay(db, newTestClient(t, s, "relay-1"), Config{DeleteSent: true})
+	enqueue(t, relay, db, 2)
+	_, err := relay.RelayOnce(context.Background())
+	if err != nil {
+		t.Fatalf("Error relaying: %v", err)
+	}
+	var rows int
+	if err = db.QueryRow("SELECT COUNT(*) FROM outbox").Scan(&rows); err != nil {
+		t.Fatalf("Error counting rows: %v", err)
+	}
+	assert.EqualValues(t, 0, rows)
+}
+
+func TestRelayReplicasDoNotShareRows(t *testing.T) {
+	s := miniredis.RunT(t)
+	db := newTestDB(t)
+	client := newTestClient(t, s, "relay-1")
+	first := NewRelay(db, client, Config{BatchSize: 2})
+	second := NewRelay(db, newTestClient(t, s, "relay-2"), Config{BatchSize: 2})
+	enqueue(t, first, db, 4)
+
+	// the first replica locks two rows and dies before producing them
+	locked, err := first.lock(context.Background())
+	if err != nil {
+		t.Fatalf("Error locking rows: %v", err)
+	}
+	assert.EqualValues(t, 2, len(locked))
+	relayed, err := second.RelayOnce(context.Background())
+	if err != nil {
+		t.Fatalf("Error relaying: %v", err)
+	}
+	assert.EqualValues(t, 2, relayed)
+	relayed, err = second.RelayOnce(context.Background())
+	if err != nil {
+		t.Fatalf("Error relaying: %v", err)
+	}
+	assert.EqualValues(t, 0, relayed)
+	assert.EqualValues(t, 2, streamLength(t, client, "orders"))
+
+	// once the lock expires the rows of the dead replica are relayed by the other one
+	_, err = db.Exec("UPDATE outbox SET locked_until = ? WHERE locked_by = 'relay-1'", time.Now().Add(-time.Second).UnixMilli())
+	if err != nil {
+		t.Fatalf("Error expiring locks: %v", err)
+	}
+	relayed, err = second.RelayOnce(context.Background())
+	if err != nil {
+		t.Fatalf("Error relaying: %v", err)
+	}
+	assert.EqualValues(t, 2, relayed)
+	assert.EqualValues(t, 4, streamLength(t, client, "orders"))
+}
+
+func TestRelayDoesNotProduceTwice(t *testing.T) {
+	s := miniredis.RunT(t)
+	db := newTestDB(t)
+	client := newTestClient(t, s, "relay-1")
+	relay := NewRelay(db, client, Config{})
+	enqueue(t, relay, db, 2)
+	_, err := relay.RelayOnce(context.Background())
+	if err != nil {
+		t.Fatalf("Error relaying: %v", err)
+	}
+	// simulate a crash between producing the rows and marking them sent
+	_, err = db.Exec("UPDATE outbox SET sent_at = NULL, locked_by = NULL, locked_until = NULL")
+	if err != nil {
+		t.Fatalf("Error resetting rows: %v", err)
+	}
+	relayed, err := relay.RelayOnce(context.Background())
+	if err != nil {
+		t.Fatalf("Error relaying: %v", err)
+	}
+	assert.EqualValues(t, 2, relayed)
+	assert.EqualValues(t, 2, streamLength(t, client, "orders"))
+}
+
+func TestEnqueueRejectsPayloadsThatCantBeProduced(t *testing.T) {
+	s := miniredis.RunT(t)
+	db := newTestDB(t)
+	relay := NewRelay(db, newTestClient(t, s, "relay-1"), Config{})
+	ctx := context.Background()
+	assert.Error(t, relay.Enqueue(ctx, db, "orders", nil))
+	assert.Error(t, relay.Enqueue(ctx, db, "orders", map[string]interface{}{"order": map[string]interface{}{"id": 1}}))
+	assert.Error(t, relay.Enqueue(ctx, db, "orders", map[string]interface{}{"items": []string{"a", "b"}}))
+	assert.Error(t, relay.Enqueue(ctx, db, "orders", map[string]interface{}{"order": nil}))
+	assert.NoError(t, relay.Enqueue(ctx, db, "orders", map[string]interface{}{"order": 1, "paid": true, "status": "created"}))
+}
+
+func TestRelaySkipsRowsThatFail(t *testing.T) {
+	s := miniredis.RunT(t)
+	db := newTestDB(t)
+	client := newTestClient(t, s, "relay-1")
+	relay := NewRelay(db, client, Config{MaxAttempts: 2, RetryDelay: time.Hour})
+	ctx := context.Background()
+	// poison rows written by something else than Enqueue, and a stream key that is not a stream
+	s.Set("not-a-stream", "value")
+	for _, row := range [][]string{
+		{"orders", `{"order": 0}`},
+		{"orders", `null`},
+		{"orders", `{"order": {"id": 1}}`},
+		{"orders", `not json`},
+		{"not-a-stream", `{"order": 2}`},
+		{"orders", `{"order": 3}`},
+	} {
+		if _, err := db.Exec("INSERT INTO outbox (stream, payload) VALUES (?, ?)", row[0], row[1]); err != nil {
+			t.Fatalf("Error inserting row: %v", err)
+		}
+	}
+	lastErrors := func() map[int64]int {
+		rows, err := db.Query("SELECT id, attempts FROM outbox WHERE last_error IS NOT NULL ORDER BY id")
+		if err != nil {
+			t.Fatalf("Error reading rows: %v", err)
+		}
+		defer rows.Close()
+		attempts := make(map[int64]int)
+		for rows.Next() {
+			var id int64
+			var count int
+			if err = rows.Scan(&id, &count); err != nil {
+				t.Fatalf("Error reading row: %v", err)
+			}
+			attempts[id] = count
+		}
+		return attempts
+	}
+
+	relayed, err := relay.RelayOnce(ctx)
+	assert.Error(t, err)
+	assert.EqualValues(t, 2, relayed)
+	assert.EqualValues(t, 2, streamLength(t, client, "orders"))
+	// undecodable rows are parked, the row that failed to be produced is retried later
+	assert.EqualValues(t, map[int64]int{2: 2, 3: 2, 4: 2, 5: 1}, lastErrors())
+	relayed, err = relay.RelayOnce(ctx)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, relayed)
+
+	// once its retry delay passed the row fails again and reaches MaxAttempts
+	if _, err = db.Exec("UPDATE outbox SET locked_until = 0 WHERE id = 5"); err != nil {
+		t.Fatalf("Error expiring retry delay: %v", err)
+	}
+	_, err = relay.RelayOnce(ctx)
+	assert.Error(t, err)
+	assert.EqualValues(t, map[int64]int{2: 2, 3: 2, 4: 2, 5: 2}, lastErrors())
+	if _, err = db.Exec("UPDATE outbox SET locked_until = 0 WHERE id = 5"); err != nil {
+		t.Fatalf("Error expiring retry delay: %v", err)
+	}
+	relayed, err = relay.RelayOnce(ctx)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, relayed)
+}
+
+func TestRelayRun(t *testing.T) {
+	s := miniredis.RunT(t)
+	db := newTestDB(t)
+	client := newTestClient(t, s, "relay-1")
+	relay := NewRelay(db, client, Config{PollInterval: 10 * time.Millisecond})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error)
+	go func() {
+		done <- relay.Run(ctx)
+	}()
+	enqueue(t, relay, db, 3)
+	assert.Eventually(t, func() bool {
+		info, err := client.StreamInfo(context.Background(), "orders")
+		return err == nil && info.Length == 3
+	}, 5*time.Second, 10*time.Millisecond)
+	cancel()
+	assert.NoError(t, <-done)
+}
+
+func TestQueryPlaceholders(t *testing.T) {
+	relay := &Relay{config: Config{Table: "events", Placeholder: DollarPlaceholders}}
+	assert.EqualValues(t, "DELETE FROM events WHERE id = $1 AND locked_by = $2",
+		relay.query("DELETE FROM %s WHERE id = ? AND locked_by = ?"))
+	relay.config.Placeholder = QuestionPlaceholders
+	assert.EqualValues(t, "DELETE FROM events WHERE id = ? AND locked_by = ?",
+		relay.query("DELETE FROM %s WHERE id = ? AND locked_by = ?"))
+}
+
+func TestRelayKeepsLargeIntegers(t *testing.T) {
+	s := miniredis.RunT(t)
+	db := newTestDB(t)
+	client := newTestClient(t, s, "relay-1")
+	relay := NewRelay(db, client, Config{})
+	ctx := context.Background()
+	// 2^53 + 1 is rounded to 2^53 by a float64
+	err := relay.Enqueue(ctx, db, "orders", map[string]interface{}{"id": int64(9007199254740993), "amount": 12.5})
+	if err != nil {
+		t.Fatalf("Error enqueuing event: %v", err)
+	}
+	relayed, err := relay.RelayOnce(ctx)
+	if err != nil {
+		t.Fatalf("Error relaying: %v", err)
+	}
+	assert.EqualValues(t, 1, relayed)
+	messages, err := client.FetchNewMessages(ctx, "orders", "billing", 10, 1)
+	if err != nil {
+		t.Fatalf("Error polling for new messages: %v", err)
+	}
+	assert.EqualValues(t, map[string]interface{}{"id": "9007199254740993", "amount": "12.5"}, messages[0].Properties)
+}
@@ -0,0 +1,181 @@
+package rediswrapper
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// AckBatcherConfig controls how an AckBatcher coalesces acks
+type AckBatcherConfig struct {
+	// MaxBatch is the number of acks that triggers an XACK right away, 100 by default
+	MaxBatch int
+	// MaxDelay is how long an ack waits for others to join its batch, 10 milliseconds by default
+	MaxDelay time.Duration
+	// Timeout bounds every XACK call, 5 seconds by default
+	Timeout time.Duration
+	// OnBatch is called with the result of every batch, it is optional
+	OnBatch func(result AckBatchResult)
+}
+
+// AckBatchResult is the outcome of one XACK sent by an AckBatcher
+type AckBatchResult struct {
+	StreamName    string
+	ConsumerGroup string
+	IDs           []string
+	// Acked is the number of messages that were pending
+	Acked int64
+	Err   error
+}
+
+// AckBatcher coalesces acks from concurrent workers into one XACK per stream and group, sent when MaxBatch acks
+// were collected or MaxDelay passed, whichever comes first
+type AckBatcher struct {
+	client *RedisStreamsClient
+	config AckBatcherConfig
+
+	mu      sync.Mutex
+	batches map[string]*ackBatch
+	closed  bool
+	// sending holds the batches taken and not sent yet, Flush waits for them
+	sending map[*ackBatch]struct{}
+}
+
+// ackBatch collects the acks of one stream and group until it is sent
+type ackBatch struct {
+	key    string
+	result AckBatchResult
+	timer  *time.Timer
+	done   chan struct{}
+}
+
+// NewAckBatcher creates an AckBatcher, Close it to send the acks still waiting. Shutdown closes it as well
+func (r *RedisStreamsClient) NewAckBatcher(config AckBatcherConfig) *AckBatcher {
+	if config.MaxBatch <= 0 {
+		config.MaxBatch = 100
+	}
+	if config.MaxDelay <= 0 {
+		config.MaxDelay = 10 * time.Millisecond
+	}
+	if config.Timeout <= 0 {
+		config.Timeout = 5 * time.Second
+	}
+	b := &AckBatcher{
+		client:  r,
+		config:  config,
+		batches: make(map[string]*ackBatch),
+		sending: make(map[*ackBatch]struct{}),
+	}
+	r.lifecycle.addAckBatcher(b)
+	return b
+}
+
+// Ack adds a message to the current batch of its stream and group and waits until the batch was sent.
+// It returns the error of the batch, or the context error if the context is done first, in which case the ack
+// is still sent with the batch
+func (b *AckBatcher) Ack(ctx context.Context, streamKey string, consumerGroup string, messageID string) error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return fmt.Errorf("ack batcher is closed")
+	}
+	key := streamKey + "\x00" + consumerGroup
+	batch, ok := b.batches[key]
+	if !ok {
+		batch = &ackBatch{
+			key:    key,
+			result: AckBatchResult{StreamName: streamKey, ConsumerGroup: consumerGroup},
+			done:   make(chan struct{}),
+		}
+		b.batches[key] = batch
+		batch.timer = time.AfterFunc(b.config.MaxDelay, func() { b.sendIfWaiting(batch) })
+	}
+	batch.result.IDs = append(batch.result.IDs, messageID)
+	full := len(batch.result.IDs) >= b.config.MaxBatch
+	if full {
+		b.take(batch)
+	}
+	b.mu.Unlock()
+	if full {
+		b.send(batch)
+	}
+	select {
+	case <-batch.done:
+		return batch.result.Err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Flush sends every batch waiting right away and waits until they and the batches already being sent were sent,
+// or until the context is done. Acks added meanwhile join new batches, which Flush does not wait for
+func (b *AckBatcher) Flush(ctx context.Context) error {
+	b.mu.Lock()
+	waiting := make([]*ackBatch, 0, len(b.batches))
+	for _, batch := range b.batches {
+		b.take(batch)
+		waiting = append(waiting, batch)
+	}
+	// batches taken before, because they were full or their delay passed, may still be sending
+	sending := make([]*ackBatch, 0, len(b.sending))
+	for batch := range b.sending {
+		sending = append(sending, batch)
+	}
+	b.mu.Unlock()
+	for _, batch := range waiting {
+		b.send(batch)
+	}
+	for _, batch := range sending {
+		select {
+		case <-batch.done:
+		case <-ctx.Done():
+			return fmt.Errorf("error flushing acks: %v", ctx.Err())
+		}
+	}
+	return nil
+}
+
+// Close flushes the batches waiting and rejects any later ack
+func (b *AckBatcher) Close(ctx context.Context) error {
+	b.mu.Lock()
+	b.closed = true
+	b.mu.Unlock()
+	b.client.lifecycle.removeAckBatcher(b)
+	return b.Flush(ctx)
+}
+
+// take removes a batch from the waiting batches, so no ack joins it anymore. b.mu must be held
+func (b *AckBatcher) take(batch *ackBatch) {
+	delete(b.batches, batch.key)
+	batch.timer.Stop()
+	b.sending[batch] = struct{}{}
+}
+
+// sendIfWaiting sends a batch when its delay passed, unless it was already taken because it was full or flushed
+func (b *AckBatcher) sendIfWaiting(batch *ackBatch) {
+	b.mu.Lock()
+	if b.batches[batch.key] != batch {
+		b.mu.Unlock()
+		return
+	}
+	b.take(batch)
+	b.mu.Unlock()
+	b.send(batch)
+}
+
+// send acks the messages of a taken batch and wakes its waiters
+func (b *AckBatcher) send(batch *ackBatch) {
+	defer func() {
+		b.mu.Lock()
+		delete(b.sending, batch)
+		b.mu.Unlock()
+		close(batch.done)
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), b.config.Timeout)
+	defer cancel()
+	batch.result.Acked, batch.result.Err = b.client.AckMessages(ctx, batch.result.StreamName, batch.result.ConsumerGroup, batch.result.IDs...)
+	if b.config.OnBatch != nil {
+		b.config.OnBatch(batch.result)
+	}
+}
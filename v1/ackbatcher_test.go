@@ -0,0 +1,166 @@
+package rediswrapper
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/a-agmon/redis-streams-wrapper/generate"
+	"github.com/stretchr/testify/assert"
+)
+
+func fetchPending(t *testing.T, c *RedisStreamsClient, stream string, group string, count int) []RedisStreamsMessage {
+	produceMessagesTo(t, c, stream, count)
+	messages, err := c.FetchNewMessages(context.Background(), stream, group, count, 1)
+	if err != nil {
+		t.Fatalf("Error polling for new messages: %v", err)
+	}
+	return messages
+}
+
+func TestAckMessages(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t, "batch-acker")
+	stream := generate.RandomStringWithPrefix("ACKSTREAM")
+	group := generate.RandomStringWithPrefix("ACKGROUP")
+	messages := fetchPending(t, c, stream, group, 3)
+	acked, err := c.AckMessages(ctx, stream, group, messages[0].ID, messages[1].ID, "9999999999999-0")
+	if err != nil {
+		t.Fatalf("Error acking messages: %v", err)
+	}
+	assert.EqualValues(t, 2, acked)
+	pending, err := c.PendingMessages(ctx, stream, group, 10)
+	if err != nil {
+		t.Fatalf("Error listing pending messages: %v", err)
+	}
+	assert.EqualValues(t, 1, len(pending))
+	acked, err = c.AckMessages(ctx, stream, group)
+	assert.NoError(t, err)
+	assert.EqualValues(t, 0, acked)
+}
+
+func TestAckBatcherCoalescesConcurrentAcks(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t, "batch-acker")
+	stream := generate.RandomStringWithPrefix("ACKSTREAM")
+	group := generate.RandomStringWithPrefix("ACKGROUP")
+	messages := fetchPending(t, c, stream, group, 250)
+
+	var mu sync.Mutex
+	results := make([]AckBatchResult, 0)
+	batcher := c.NewAckBatcher(AckBatcherConfig{MaxBatch: 100, MaxDelay: 50 * time.Millisecond, OnBatch: func(result AckBatchResult) {
+		mu.Lock()
+		defer mu.Unlock()
+		results = append(results, result)
+	}})
+	var workers sync.WaitGroup
+	for _, message := range messages {
+		workers.Add(1)
+		go func(id string) {
+			defer workers.Done()
+			assert.NoError(t, batcher.Ack(ctx, stream, group, id))
+		}(message.ID)
+	}
+	workers.Wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	acked := int64(0)
+	for _, result := range results {
+		assert.NoError(t, result.Err)
+		assert.LessOrEqual(t, len(result.IDs), 100)
+		acked += result.Acked
+	}
+	assert.EqualValues(t, 250, acked)
+	assert.Less(t, len(results), 250)
+	pending, err := c.PendingMessages(ctx, stream, group, 10)
+	if err != nil {
+		t.Fatalf("Error listing pending messages: %v", err)
+	}
+	assert.EqualValues(t, 0, len(pending))
+}
+
+func TestAckBatcherFlushAndClose(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t, "batch-acker")
+	stream := generate.RandomStringWithPrefix("ACKSTREAM")
+	group := generate.RandomStringWithPrefix("ACKGROUP")
+	messages := fetchPending(t, c, stream, group, 2)
+	// the delay is long enough that only the flush can send the batch
+	batcher := c.NewAckBatcher(AckBatcherConfig{MaxDelay: time.Hour})
+	done := make(chan error)
+	go func() {
+		done <- batcher.Ack(ctx, stream, group, messages[0].ID)
+	}()
+	assert.Eventually(t, func() bool {
+		batcher.mu.Lock()
+		defer batcher.mu.Unlock()
+		return len(batcher.batches) == 1
+	}, time.Second, time.Millisecond)
+	assert.NoError(t, batcher.Close(ctx))
+	assert.NoError(t, <-done)
+	assert.Error(t, batcher.Ack(ctx, stream, group, messages[1].ID))
+	pending, err := c.PendingMessages(ctx, stream, group, 10)
+	if err != nil {
+		t.Fatalf("Error listing pending messages: %v", err)
+	}
+	assert.EqualValues(t, 1, len(pending))
+}
+
+func TestAckBatcherFlushWaitsForBatchesBeingSent(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t, "batch-acker")
+	stream := generate.RandomStringWithPrefix("ACKSTREAM")
+	group := generate.RandomStringWithPrefix("ACKGROUP")
+	messages := fetchPending(t, c, stream, group, 1)
+	sending := make(chan struct{})
+	release := make(chan struct{})
+	batcher := c.NewAckBatcher(AckBatcherConfig{MaxBatch: 1, OnBatch: func(result AckBatchResult) {
+		close(sending)
+		<-release
+	}})
+	acked := make(chan error, 1)
+	go func() {
+		acked <- batcher.Ack(ctx, stream, group, messages[0].ID)
+	}()
+	<-sending
+	// the full batch is still being sent, the flush gives up when its context is done
+	timeoutCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	assert.Error(t, batcher.Flush(timeoutCtx))
+	flushed := make(chan error, 1)
+	go func() {
+		flushed <- batcher.Flush(ctx)
+	}()
+	close(release)
+	assert.NoError(t, <-flushed)
+	assert.NoError(t, <-acked)
+}
+
+func TestAckBatcherFlushWhileAcking(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t, "batch-acker")
+	stream := generate.RandomStringWithPrefix("ACKSTREAM")
+	group := generate.RandomStringWithPrefix("ACKGROUP")
+	messages := fetchPending(t, c, stream, group, 50)
+	batcher := c.NewAckBatcher(AckBatcherConfig{MaxBatch: 3, MaxDelay: time.Millisecond})
+	var acks sync.WaitGroup
+	for _, message := range messages {
+		acks.Add(1)
+		go func(id string) {
+			defer acks.Done()
+			assert.NoError(t, batcher.Ack(ctx, stream, group, id))
+		}(message.ID)
+	}
+	for i := 0; i < 20; i++ {
+		assert.NoError(t, batcher.Flush(ctx))
+	}
+	acks.Wait()
+	assert.NoError(t, batcher.Close(ctx))
+	pending, err := c.PendingMessages(ctx, stream, group, 100)
+	if err != nil {
+		t.Fatalf("Error listing pending messages: %v", err)
+	}
+	assert.EqualValues(t, 0, len(pending))
+}
@@ -0,0 +1,241 @@
+package rediswrapper
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ConsumerCleanupConfig controls the removal of stale consumers from a consumer group.
+// When used as part of a Subscription, cleanup is disabled when Interval is zero
+type ConsumerCleanupConfig struct {
+	// Interval is how often a Subscription looks for stale consumers
+	Interval time.Duration
+	// MaxIdle is how long a consumer must be idle before it is considered stale, 1 hour by default in a Subscription
+	MaxIdle time.Duration
+	// ReclaimPending claims the pending entries of a stale consumer to this client's consumer before removing it.
+	// Otherwise consumers with pending entries are kept, as deleting them would drop their entries from the PEL
+	ReclaimPending bool
+}
+
+// RemoveStaleConsumers deletes consumers of a group that have been idle for at least maxIdle.
+// The client's own consumer is never removed. It returns the names of the removed consumers
+// it requires the following parameters:
+// streamKey: the stream key of the consumer group
+// consumerGroup: the consumer group to clean up
+// maxIdle: the minimum idle time for a consumer to be considered stale, it must be positive
+// reclaimPending: whether pending entries of stale consumers should be claimed by this consumer before removing them
+func (r *RedisStreamsClient) RemoveStaleConsumers(ctx context.Context, streamKey string, consumerGroup string, maxIdle time.Duration, reclaimPending bool) ([]string, error) {
+	// with no idle threshold every consumer of the group, including live ones, would be removed
+	if maxIdle <= 0 {
+		return nil, fmt.Errorf("max idle of stale consumers must be positive, got %v", maxIdle)
+	}
+	consumers, err := r.ConsumersInfo(ctx, streamKey, consumerGroup)
+	if err != nil {
+		return nil, err
+	}
+	removed := make([]string, 0)
+	for _, consumer := range consumers {
+		if consumer.Name == r.Config.ConsumerName || consumer.Idle < maxIdle {
+			continue
+		}
+		if consumer.Pending > 0 {
+			if !reclaimPending {
+				log.Printf("Keeping stale consumer %s on group %s, it still has %d pending messages\n", consumer.Name, consumerGroup, consumer.Pending)
+				continue
+			}
+			err = r.claimAllPendingOf(ctx, streamKey, consumerGroup, consumer.Name)
+			if err != nil {
+				return removed, fmt.Errorf("error claiming pending messages of consumer %s: %v", consumer.Name, err)
+			}
+		}
+		err = r.client.XGroupDelConsumer(ctx, streamKey, consumerGroup, consumer.Name).Err()
+		if err != nil {
+			return removed, fmt.Errorf("error deleting consumer %s from group %s: %v", consumer.Name, consumerGroup, err)
+		}
+		log.Printf("Removed stale consumer %s from group %s on stream %s\n", consumer.Name, consumerGroup, streamKey)
+		removed = append(removed, consumer.Name)
+	}
+	return removed, nil
+}
+
+// sameIDs reports whether two lists of message IDs are equal
+func sameIDs(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// claimAllPendingOf moves every pending entry of the given consumer to this client's consumer
+func (r *RedisStreamsClient) claimAllPendingOf(ctx context.Context, streamKey string, consumerGroup string, consumerName string) error {
+	var previous []string
+	for {
+		pending, err := r.client.XPendingExt(ctx, &redis.XPendingExtArgs{
+			Stream:   streamKey,
+			Group:    consumerGroup,
+			Start:    "-",
+			End:      "+",
+			Count:    100,
+			Consumer: consumerName,
+		}).Result()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+		if len(pending) == 0 {
+			return nil
+		}
+		ids := make([]string, 0, len(pending))
+		for _, pendingMsg := range pending {
+			ids = append(ids, pendingMsg.ID)
+		}
+		// the same entries still pending after a claim can't be moved, stop instead of looping forever
+		if sameIDs(ids, previous) {
+			return fmt.Errorf("none of %d pending messages could be claimed", len(ids))
+		}
+		previous = ids
+		claimed, err := r.client.XClaimJustID(ctx, &redis.XClaimArgs{
+			Stream:   streamKey,
+			Group:    consumerGroup,
+			Consumer: r.Config.ConsumerName,
+			Messages: ids,
+		}).Result()
+		if err != nil {
+			return err
+		}
+		// XCLAIM leaves out entries that were trimmed or deleted, Redis 7 drops them from the PEL as well
+		log.Printf("Claimed %d pending messages from stale consumer %s\n", len(claimed), consumerName)
+	}
+}
+
+// GroupMove describes moving the last delivered ID of a consumer group
+type GroupMove struct {
+	StreamName    string
+	ConsumerGroup string
+	// FromID is the last delivered ID of the group before the move
+	FromID string
+	// ToID is the last delivered ID of the group after the move
+	ToID string
+	// Redelivered is the number of entries that will be delivered again, when the group moves back
+	Redelivered int64
+	// Skipped is the number of entries that will never be delivered, when the group moves forward
+	Skipped int64
+	// DryRun is set when the group was not actually moved
+	DryRun bool
+}
+
+// MoveGroupToID sets the last delivered ID of a consumer group with XGROUP SETID, so the next entries delivered
+// are the ones after id. Moving back re-delivers entries, moving forward skips them. Pending entries are kept,
+// they still have to be acked or claimed
+// it requires the following parameters:
+// streamKey: the stream key of the consumer group
+// consumerGroup: the consumer group to move
+// id: the new last delivered ID, 0 to re-deliver the whole stream
+// dryRun: only report how many entries would be re-delivered or skipped, without moving the group
+func (r *RedisStreamsClient) MoveGroupToID(ctx context.Context, streamKey string, consumerGroup string, id string, dryRun bool) (*GroupMove, error) {
+	ms, seq, err := parseStreamID(id)
+	if err != nil {
+		return nil, err
+	}
+	id = fmt.Sprintf("%d-%d", ms, seq)
+	return r.moveGroup(ctx, streamKey, consumerGroup, id, id, dryRun)
+}
+
+// MoveGroupToTime moves a consumer group so the next entries delivered are the ones added at or after the given time,
+// e.g. to reprocess the last two hours after a bug fix
+// it requires the following parameters:
+// streamKey: the stream key of the consumer group
+// consumerGroup: the consumer group to move
+// t: the time of the first entry delivered after the move
+// dryRun: only report how many entries would be re-delivered or skipped, without moving the group
+func (r *RedisStreamsClient) MoveGroupToTime(ctx context.Context, streamKey string, consumerGroup string, t time.Time, dryRun bool) (*GroupMove, error) {
+	id, ok, err := prevStreamID(StreamIDFromTime(t))
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		id = "0-0"
+	}
+	return r.moveGroup(ctx, streamKey, consumerGroup, id, id, dryRun)
+}
+
+// MoveGroupToEnd moves a consumer group to the end of the stream, skipping every entry not delivered yet
+// it requires the following parameters:
+// streamKey: the stream key of the consumer group
+// consumerGroup: the consumer group to move
+// dryRun: only report how many entries would be skipped, without moving the group
+func (r *RedisStreamsClient) MoveGroupToEnd(ctx context.Context, streamKey string, consumerGroup string, dryRun bool) (*GroupMove, error) {
+	last, err := r.ReadRangeReverse(ctx, streamKey, "+", "-", 1)
+	if err != nil {
+		return nil, err
+	}
+	id := "0-0"
+	if len(last) == 1 {
+		id = last[0].ID
+	}
+	// $ rather than the last ID, so entries added while counting are skipped as well
+	return r.moveGroup(ctx, streamKey, consumerGroup, id, "$", dryRun)
+}
+
+// moveGroup counts the entries between the current and the new position of a group, and moves it unless dryRun is set
+func (r *RedisStreamsClient) moveGroup(ctx context.Context, streamKey string, consumerGroup string, toID string, setID string, dryRun bool) (*GroupMove, error) {
+	group, err := r.GroupInfo(ctx, streamKey, consumerGroup)
+	if err != nil {
+		return nil, err
+	}
+	move := &GroupMove{
+		StreamName:    streamKey,
+		ConsumerGroup: consumerGroup,
+		FromID:        group.LastDeliveredID,
+		ToID:          toID,
+		DryRun:        dryRun,
+	}
+	cmp, err := compareStreamIDs(toID, group.LastDeliveredID)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case cmp < 0:
+		move.Redelivered, err = r.countEntriesAfter(ctx, streamKey, toID, group.LastDeliveredID)
+	case cmp > 0:
+		move.Skipped, err = r.countEntriesAfter(ctx, streamKey, group.LastDeliveredID, toID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if dryRun {
+		return move, nil
+	}
+	err = r.client.XGroupSetID(ctx, streamKey, consumerGroup, setID).Err()
+	if err != nil {
+		return nil, fmt.Errorf("error moving group %s on stream %s to %s: %v", consumerGroup, streamKey, setID, err)
+	}
+	log.Printf("Moved group %s on stream %s from %s to %s, %d entries re-delivered and %d skipped\n",
+		consumerGroup, streamKey, move.FromID, setID, move.Redelivered, move.Skipped)
+	return move, nil
+}
+
+// countEntriesAfter counts the entries with an ID greater than after and up to end included
+func (r *RedisStreamsClient) countEntriesAfter(ctx context.Context, streamKey string, after string, end string) (int64, error) {
+	start, err := nextStreamID(after)
+	if err != nil {
+		return 0, err
+	}
+	count := int64(0)
+	it := r.IterateRange(streamKey, StreamRange{Start: start, End: end}, IteratorOptions{PageSize: lagPageSize})
+	for it.Next(ctx) {
+		count++
+	}
+	if err = it.Err(); err != nil {
+		return 0, fmt.Errorf("error counting entries of stream %s: %v", streamKey, err)
+	}
+	return count, nil
+}
@@ -0,0 +1,255 @@
+package rediswrapper
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/a-agmon/redis-streams-wrapper/generate"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+// idleHook sets the idle time XINFO CONSUMERS reports for some consumers, as miniredis does not track it
+type idleHook struct {
+	idle map[string]time.Duration
+}
+
+func (h *idleHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h *idleHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		err := next(ctx, cmd)
+		if consumersCmd, ok := cmd.(*redis.XInfoConsumersCmd); ok && err == nil {
+			consumers := consumersCmd.Val()
+			for i := range consumers {
+				consumers[i].Idle = h.idle[consumers[i].Name]
+			}
+		}
+		return err
+	}
+}
+
+func (h *idleHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return next
+}
+
+func TestRemoveStaleConsumers(t *testing.T) {
+	ctx := context.Background()
+	stream := generate.RandomStringWithPrefix("ADMINSTREAM")
+	group := generate.RandomStringWithPrefix("ADMINGROUP")
+	// one consumer that read everything it got, one that died with pending messages and one that is still active
+	idleConsumer := newTestClient(t, "idle-consumer")
+	deadConsumer := newTestClient(t, "dead-consumer")
+	activeConsumer := newTestClient(t, "active-consumer")
+	err := idleConsumer.ProduceMessage(ctx, stream, map[string]interface{}{"test": "test"})
+	if err != nil {
+		t.Fatalf("Error producing message: %v", err)
+	}
+	messages, err := idleConsumer.FetchNewMessages(ctx, stream, group, 1, 1)
+	if err != nil {
+		t.Fatalf("Error polling for new messages: %v", err)
+	}
+	err = idleConsumer.AckMessage(ctx, stream, group, messages[0].ID)
+	if err != nil {
+		t.Fatalf("Error acking message: %v", err)
+	}
+	produceMessagesTo(t, deadConsumer, stream, 3)
+	_, err = deadConsumer.FetchNewMessages(ctx, stream, group, 3, 1)
+	if err != nil {
+		t.Fatalf("Error polling for new messages: %v", err)
+	}
+	produceMessagesTo(t, activeConsumer, stream, 1)
+	_, err = activeConsumer.FetchNewMessages(ctx, stream, group, 1, 1)
+	if err != nil {
+		t.Fatalf("Error polling for new messages: %v", err)
+	}
+
+	admin := newTestClient(t, "admin-consumer")
+	admin.client.AddHook(&idleHook{idle: map[string]time.Duration{
+		"idle-consumer":   2 * time.Hour,
+		"dead-consumer":   2 * time.Hour,
+		"active-consumer": time.Minute,
+	}})
+	_, err = admin.FetchNewMessages(ctx, stream, group, 1, 1)
+	if err != nil {
+		t.Fatalf("Error polling for new messages: %v", err)
+	}
+	// without an idle threshold every consumer would be stale
+	_, err = admin.RemoveStaleConsumers(ctx, stream, group, 0, false)
+	assert.Error(t, err)
+	// without reclaiming, the consumer with pending messages must be kept
+	removed, err := admin.RemoveStaleConsumers(ctx, stream, group, time.Hour, false)
+	if err != nil {
+		t.Fatalf("Error removing stale consumers: %v", err)
+	}
+	assert.EqualValues(t, []string{"idle-consumer"}, removed)
+	// with reclaiming its messages are moved to the admin consumer first
+	removed, err = admin.RemoveStaleConsumers(ctx, stream, group, time.Hour, true)
+	if err != nil {
+		t.Fatalf("Error removing stale consumers: %v", err)
+	}
+	assert.EqualValues(t, []string{"dead-consumer"}, removed)
+	pending, err := admin.client.XPending(ctx, stream, group).Result()
+	if err != nil {
+		t.Fatalf("Error fetching pending summary: %v", err)
+	}
+	assert.EqualValues(t, 4, pending.Count)
+	assert.EqualValues(t, map[string]int64{"admin-consumer": 3, "active-consumer": 1}, pending.Consumers)
+	consumers, err := admin.ConsumersInfo(ctx, stream, group)
+	if err != nil {
+		t.Fatalf("Error fetching consumers: %v", err)
+	}
+	assert.EqualValues(t, 2, len(consumers))
+
+	sub := admin.Subscribe(SubscriptionConfig{StreamName: stream, ConsumerGroup: group, Cleanup: ConsumerCleanupConfig{Interval: time.Minute}},
+		func(ctx context.Context, msg RedisStreamsMessage) error { return nil })
+	assert.EqualValues(t, time.Hour, sub.config.Cleanup.MaxIdle)
+}
+
+func produceMessagesTo(t *testing.T, c *RedisStreamsClient, stream string, count int) {
+	for i := 0; i < count; i++ {
+		err := c.ProduceMessage(context.Background(), stream, map[string]interface{}{"messageindex": i})
+		if err != nil {
+			t.Fatalf("Error producing message: %v", err)
+		}
+	}
+}
+
+// setIDHook answers XGROUP SETID, which miniredis does not support, and records its arguments
+type setIDHook struct {
+	args []interface{}
+}
+
+func (h *setIDHook) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return next(ctx, network, addr)
+	}
+}
+
+func (h *setIDHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		if cmd.Name() == "xgroup" && len(cmd.Args()) > 1 && cmd.Args()[1] == "setid" {
+			h.args = cmd.Args()
+			cmd.(*redis.StatusCmd).SetVal("OK")
+			return nil
+		}
+		return next(ctx, cmd)
+	}
+}
+
+func (h *setIDHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return next
+}
+
+func TestMoveGroup(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t, "admin-consumer")
+	stream := generate.RandomStringWithPrefix("ADMINSTREAM")
+	group := generate.RandomStringWithPrefix("ADMINGROUP")
+	addEntriesWithIDs(t, c, stream, "1000-0", "2000-0", "3000-0", "4000-0", "5000-0")
+	// the group has consumed up to 3000-0
+	messages, err := c.FetchNewMessages(ctx, stream, group, 3, 1)
+	if err != nil {
+		t.Fatalf("Error polling for new messages: %v", err)
+	}
+	assert.EqualValues(t, 3, len(messages))
+
+	move, err := c.MoveGroupToID(ctx, stream, group, "1000", true)
+	if err != nil {
+		t.Fatalf("Error moving group: %v", err)
+	}
+	assert.EqualValues(t, GroupMove{StreamName: stream, ConsumerGroup: group, FromID: "3000-0", ToID: "1000-0", Redelivered: 2, DryRun: true}, *move)
+	move, err = c.MoveGroupToTime(ctx, stream, group, time.UnixMilli(2000), true)
+	if err != nil {
+		t.Fatalf("Error moving group: %v", err)
+	}
+	assert.EqualValues(t, "1999-18446744073709551615", move.ToID)
+	assert.EqualValues(t, 2, move.Redelivered)
+	move, err = c.MoveGroupToEnd(ctx, stream, group, true)
+	if err != nil {
+		t.Fatalf("Error moving group: %v", err)
+	}
+	assert.EqualValues(t, "5000-0", move.ToID)
+	assert.EqualValues(t, 2, move.Skipped)
+	assert.EqualValues(t, 0, move.Redelivered)
+
+	hook := &setIDHook{}
+	c.client.AddHook(hook)
+	move, err = c.MoveGroupToEnd(ctx, stream, group, false)
+	if err != nil {
+		t.Fatalf("Error moving group: %v", err)
+	}
+	assert.False(t, move.DryRun)
+	assert.EqualValues(t, []interface{}{"xgroup", "setid", stream, group, "$"}, hook.args)
+
+	_, err = c.MoveGroupToID(ctx, stream, "missing-group", "0", true)
+	assert.Error(t, err)
+	_, err = c.MoveGroupToID(ctx, stream, group, "not-an-id", true)
+	assert.Error(t, err)
+}
+
+// trimmedClaimHook answers XCLAIM as Redis 7 does for entries that were trimmed: nothing is returned, and the
+// entries are dropped from the PEL when dropFromPEL is set
+type trimmedClaimHook struct {
+	dropFromPEL bool
+}
+
+func (h *trimmedClaimHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h *trimmedClaimHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		claimCmd, ok := cmd.(*redis.StringSliceCmd)
+		if !ok || cmd.Name() != "xclaim" {
+			return next(ctx, cmd)
+		}
+		args := cmd.Args()
+		if h.dropFromPEL {
+			ackArgs := []interface{}{"xack", args[1], args[2]}
+			for _, arg := range args[5:] {
+				if arg == "justid" {
+					break
+				}
+				ackArgs = append(ackArgs, arg)
+			}
+			if err := next(ctx, redis.NewIntCmd(ctx, ackArgs...)); err != nil {
+				return err
+			}
+		}
+		claimCmd.SetVal([]string{})
+		return nil
+	}
+}
+
+func (h *trimmedClaimHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return next
+}
+
+func TestClaimAllPendingOfTrimmedEntries(t *testing.T) {
+	ctx := context.Background()
+	stream := generate.RandomStringWithPrefix("ADMINSTREAM")
+	group := generate.RandomStringWithPrefix("ADMINGROUP")
+	dead := newTestClient(t, "dead-consumer")
+	fetchPending(t, dead, stream, group, 3)
+
+	// entries XCLAIM drops from the PEL are gone, which is not a failure
+	admin := newTestClient(t, "admin-consumer")
+	admin.client.AddHook(&trimmedClaimHook{dropFromPEL: true})
+	assert.NoError(t, admin.claimAllPendingOf(ctx, stream, group, "dead-consumer"))
+	pending, err := admin.PendingMessages(ctx, stream, group, 10)
+	if err != nil {
+		t.Fatalf("Error listing pending messages: %v", err)
+	}
+	assert.EqualValues(t, 0, len(pending))
+
+	// entries that stay pending after the claim can't be moved
+	fetchPending(t, dead, stream, group, 2)
+	stuck := newTestClient(t, "admin-consumer")
+	stuck.client.AddHook(&trimmedClaimHook{})
+	assert.Error(t, stuck.claimAllPendingOf(ctx, stream, group, "dead-consumer"))
+}
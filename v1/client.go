@@ -8,6 +8,24 @@ import (
 
 	"github.com/a-agmon/redis-streams-wrapper/generate"
 	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ConsumerIdentity selects how a consumer name is generated when RedisClientConfig.ConsumerName is empty
+type ConsumerIdentity int
+
+const (
+	// RandomIdentity generates a random name with a timestamp, a new one on every start
+	RandomIdentity ConsumerIdentity = iota
+	// HostnamePIDIdentity uses the hostname and process id
+	HostnamePIDIdentity
+	// PodNameIdentity uses the Kubernetes pod name read from RedisClientConfig.PodNameEnv (POD_NAME by default)
+	PodNameIdentity
+	// ULIDIdentity uses a ULID generated from crypto/rand
+	ULIDIdentity
+	// PersistedIdentity reuses the name stored in RedisClientConfig.ConsumerNameFile, creating it on first start
+	PersistedIdentity
 )
 
 type RedisClientConfig struct {
@@ -16,11 +34,26 @@ type RedisClientConfig struct {
 	Password     string
 	DB           int
 	ConsumerName string
+	// ConsumerIdentity is used to generate ConsumerName when it is not provided
+	ConsumerIdentity ConsumerIdentity
+	PodNameEnv       string
+	ConsumerNameFile string
+	// Observer is notified of every produce, fetch, ack and claim call, it is optional
+	Observer Observer
+	// TracerProvider creates the producer and consumer spans, the global provider is used when nil
+	TracerProvider trace.TracerProvider
+	// Propagator injects trace context into message fields on produce, W3C trace context is used when nil
+	Propagator propagation.TextMapPropagator
+	// ClusterMode should be set when Addr is a Redis Cluster node, operations on several keys then check
+	// that the keys share a hash slot
+	ClusterMode bool
 }
 
 type RedisStreamsClient struct {
-	client *redis.Client
-	Config RedisClientConfig
+	client    *redis.Client
+	Config    RedisClientConfig
+	producer  producer
+	lifecycle lifecycle
 }
 
 type RedisStreamsMessage struct {
@@ -32,7 +65,7 @@ type RedisStreamsMessage struct {
 }
 
 // NewRedisClientWrapper  creates a new RedisStreamsClient, it also accepts a RedisClientConfig struct as well as optional string for
-// consumer name. If consumer name is not provided a random string will be generated.
+// consumer name. If consumer name is not provided one is generated according to config.ConsumerIdentity (random by default).
 // The idea is to create a stateless consumer/producer that can send/poll messages to/from any topic using any consumer group they choose
 func NewRedisClientWrapper(config RedisClientConfig) *RedisStreamsClient {
 	client := redis.NewClient(&redis.Options{
@@ -45,14 +78,36 @@ func NewRedisClientWrapper(config RedisClientConfig) *RedisStreamsClient {
 		client: client,
 		Config: config,
 	}
-	// if consumer name is empty then generate a random one
+	// if consumer name is empty then generate one using the configured identity
 	if clientWrapper.Config.ConsumerName == "" {
-		clientWrapper.Config.ConsumerName = generate.RandomStringWithPrefix("consumer")
-		log.Printf("Consumer name not provided, generated random consumer name: %s", clientWrapper.Config.ConsumerName)
+		consumerName, err := generateConsumerName(config)
+		if err != nil {
+			log.Printf("Error generating consumer name, falling back to a random one: %v", err)
+			consumerName = generate.RandomStringWithPrefix("consumer")
+		}
+		clientWrapper.Config.ConsumerName = consumerName
+		log.Printf("Consumer name not provided, generated consumer name: %s", clientWrapper.Config.ConsumerName)
 	}
 	return clientWrapper
 }
 
+func generateConsumerName(config RedisClientConfig) (string, error) {
+	switch config.ConsumerIdentity {
+	case RandomIdentity:
+		return generate.RandomStringWithPrefix("consumer"), nil
+	case HostnamePIDIdentity:
+		return generate.HostnamePIDWithPrefix("consumer")
+	case PodNameIdentity:
+		return generate.PodNameWithPrefix("consumer", config.PodNameEnv)
+	case ULIDIdentity:
+		return generate.ULIDWithPrefix("consumer")
+	case PersistedIdentity:
+		return generate.PersistedWithPrefix("consumer", config.ConsumerNameFile)
+	default:
+		return "", fmt.Errorf("unknown consumer identity %d", config.ConsumerIdentity)
+	}
+}
+
 // CreateConsumerGroupIfNotExists creates a consumer group if it does not exist
 // it requires the following parameters:
 // streamKey: the stream key to create the consumer group on
@@ -78,14 +133,10 @@ func (r *RedisStreamsClient) createConsumerGroupIfNotExists(ctx context.Context,
 // streamKey: the stream key to produce the message to
 // properties: a map of key value pairs that will be sent as part of the message
 func (r *RedisStreamsClient) ProduceMessage(ctx context.Context, streamKey string, payload map[string]interface{}) error {
-	id, err := r.client.XAdd(ctx, &redis.XAddArgs{
-		Stream: streamKey,
-		Values: payload,
-	}).Result()
+	_, err := r.produce(ctx, []RedisStreamsMessage{{StreamName: streamKey, Properties: copyPayload(payload)}})
 	if err != nil {
 		return fmt.Errorf("eror producing message: %v", err)
 	}
-	log.Printf("Produced message %s to stream: %s\n", id, streamKey)
 	return nil
 }
 
@@ -117,6 +168,7 @@ func (r *RedisStreamsClient) FetchNewMessages(ctx context.Context, streamKey str
 		return nil, fmt.Errorf("error ensuring consumer group exists: %v", err)
 	}
 	// now poll for new messages
+	start := time.Now()
 	streams, err := r.client.XReadGroup(ctx, &redis.XReadGroupArgs{
 		Group:    consumerGroup,
 		Consumer: r.Config.ConsumerName,
@@ -124,6 +176,7 @@ func (r *RedisStreamsClient) FetchNewMessages(ctx context.Context, streamKey str
 		Count:    int64(count),
 		Block:    time.Duration(waitForSeconds) * time.Second,
 	}).Result()
+	r.observeFetch(streamKey, consumerGroup, streams, start, err)
 	if err != nil {
 		if err == redis.Nil { // nothing was received after the block time
 			return []RedisStreamsMessage{}, nil
@@ -166,6 +219,7 @@ func (r *RedisStreamsClient) FetchNewMessagesWithCB(
 	if err != nil {
 		return fmt.Errorf("error ensuring consumer group exists: %v", err)
 	}
+	start := time.Now()
 	streams, err := r.client.XReadGroup(ctx, &redis.XReadGroupArgs{
 		Group:    consumerGroup,
 		Consumer: r.Config.ConsumerName,
@@ -173,6 +227,7 @@ func (r *RedisStreamsClient) FetchNewMessagesWithCB(
 		Count:    int64(count),
 		Block:    time.Duration(waitForSeconds) * time.Second,
 	}).Result()
+	r.observeFetch(streamKey, consumerGroup, streams, start, err)
 	if err != nil {
 		if err == redis.Nil { // nothing was received after the block time
 			return nil
@@ -198,7 +253,9 @@ func (r *RedisStreamsClient) FetchNewMessagesWithCB(
 // consumerGroup: the consumer group to acknowledge the message from
 // messageID: the message ID to acknowledge
 func (r *RedisStreamsClient) AckMessage(ctx context.Context, streamKey string, consumerGroup string, messageID string) error {
+	start := time.Now()
 	err := r.client.XAck(ctx, streamKey, consumerGroup, messageID).Err()
+	r.observeOperation(OperationAck, streamKey, consumerGroup, 1, start, err)
 	if err != nil {
 		return fmt.Errorf("error acknowledging message: %v", err)
 	}
@@ -206,12 +263,36 @@ func (r *RedisStreamsClient) AckMessage(ctx context.Context, streamKey string, c
 	return nil
 }
 
+// AckMessages acknowledges several messages of the given consumer group with a single XACK and returns the number
+// of messages that were pending
+// it requires the following parameters:
+// streamKey: the stream key to acknowledge the messages from
+// consumerGroup: the consumer group to acknowledge the messages from
+// messageIDs: the message IDs to acknowledge
+func (r *RedisStreamsClient) AckMessages(ctx context.Context, streamKey string, consumerGroup string, messageIDs ...string) (int64, error) {
+	if len(messageIDs) == 0 {
+		return 0, nil
+	}
+	start := time.Now()
+	acked, err := r.client.XAck(ctx, streamKey, consumerGroup, messageIDs...).Result()
+	r.observeOperation(OperationAck, streamKey, consumerGroup, len(messageIDs), start, err)
+	if err != nil {
+		return 0, fmt.Errorf("error acknowledging messages: %v", err)
+	}
+	log.Printf("Consumer %s Acknowledged %d of %d messages on group %s \n", r.Config.ConsumerName, acked, len(messageIDs), consumerGroup)
+	return acked, nil
+}
+
 // ClaimMessagesNotAcked  claims pending messages for the given consumer group
 // it requires the following parameters:
 // streamKey: the stream key to claim messages from
 // consumerGroup: the consumer group to claim messages from
 // minIdleSeconds: the minimum idle time in seconds for a message to be considered for claiming - Return only messages that are idle for at least
-func (r *RedisStreamsClient) ClaimMessagesNotAcked(ctx context.Context, streamKey string, consumerGroup string, count int64, minIdleSeconds int) ([]RedisStreamsMessage, error) {
+func (r *RedisStreamsClient) ClaimMessagesNotAcked(ctx context.Context, streamKey string, consumerGroup string, count int64, minIdleSeconds int) (claimedMessages []RedisStreamsMessage, err error) {
+	start := time.Now()
+	defer func() {
+		r.observeOperation(OperationClaim, streamKey, consumerGroup, len(claimedMessages), start, err)
+	}()
 	pending, err := r.client.XPendingExt(ctx, &redis.XPendingExtArgs{
 		Stream: streamKey,
 		Group:  consumerGroup,
@@ -230,7 +311,7 @@ func (r *RedisStreamsClient) ClaimMessagesNotAcked(ctx context.Context, streamKe
 		log.Printf("No pending messages found for group %s on stream %s by consumer %s \n", consumerGroup, streamKey, r.Config.ConsumerName)
 		return []RedisStreamsMessage{}, nil
 	}
-	claimedMessages := make([]RedisStreamsMessage, 0)
+	claimedMessages = make([]RedisStreamsMessage, 0)
 	idleClaimedDuration := time.Duration(minIdleSeconds) * time.Second
 	// Iterate over pending messages returned and claim them one by one
 	for _, pendingMsg := range pending {
@@ -281,12 +362,13 @@ func (r *RedisStreamsClient) transformXMessageToRedisStreamsMessage(xMessage *re
 }
 
 // CloseConnection closeConnection closes the redis connection, though it should be alive and shared between routines.
+// Closing a connection that is already closed, e.g. by Shutdown, only logs the error
 func (r *RedisStreamsClient) CloseConnection() {
 	if r.client != nil {
 		err := r.client.Close()
 		if err != nil {
 			log.Printf("Error closing redis connection: %v\n", err)
-			panic(err)
+			return
 		}
 	}
 
@@ -3,6 +3,7 @@ package rediswrapper
 import (
 	"context"
 	"log"
+	"path/filepath"
 	"testing"
 	"time"
 
@@ -14,6 +15,7 @@ import (
 var testStreamName = generate.RandomStringWithPrefix("STREAM")
 var testConsumerGroup = generate.RandomStringWithPrefix("GROUP")
 var client *RedisStreamsClient
+var testRedisServer *miniredis.Miniredis
 
 func TestMain(m *testing.M) {
 	log.Print("Starting mini redis server")
@@ -22,6 +24,7 @@ func TestMain(m *testing.M) {
 		log.Fatalf("Error creating miniredis server: %v", err)
 	}
 	log.Printf("Miniredis server created on %v", s.Addr())
+	testRedisServer = s
 	client = NewRedisClientWrapper(RedisClientConfig{
 		Addr:     s.Addr(),
 		DB:       0,
@@ -33,6 +36,17 @@ func TestMain(m *testing.M) {
 	s.Close()
 }
 
+// newTestClient creates a client on the shared miniredis server that is closed when the test ends
+// tests in other files should use it rather than the shared client, which is closed by TestCloseConnection
+func newTestClient(t *testing.T, consumerName string) *RedisStreamsClient {
+	c := NewRedisClientWrapper(RedisClientConfig{
+		Addr:         testRedisServer.Addr(),
+		ConsumerName: consumerName,
+	})
+	t.Cleanup(c.CloseConnection)
+	return c
+}
+
 // todo: we need to test for bad consumer names
 
 func TestProduceMessage(t *testing.T) {
@@ -238,6 +252,25 @@ func TestConsumerGroupExists(t *testing.T) {
 
 }
 
+func TestConsumerIdentity(t *testing.T) {
+	t.Setenv("POD_NAME", "orders-7d9f-abcde")
+	podClient := NewRedisClientWrapper(RedisClientConfig{Addr: testRedisServer.Addr(), ConsumerIdentity: PodNameIdentity})
+	defer podClient.CloseConnection()
+	assert.EqualValues(t, "consumer-orders-7d9f-abcde", podClient.Config.ConsumerName)
+
+	path := filepath.Join(t.TempDir(), "consumer-name")
+	first := NewRedisClientWrapper(RedisClientConfig{Addr: testRedisServer.Addr(), ConsumerIdentity: PersistedIdentity, ConsumerNameFile: path})
+	defer first.CloseConnection()
+	second := NewRedisClientWrapper(RedisClientConfig{Addr: testRedisServer.Addr(), ConsumerIdentity: PersistedIdentity, ConsumerNameFile: path})
+	defer second.CloseConnection()
+	assert.EqualValues(t, first.Config.ConsumerName, second.Config.ConsumerName)
+
+	// an explicit consumer name always wins
+	named := NewRedisClientWrapper(RedisClientConfig{Addr: testRedisServer.Addr(), ConsumerName: "named", ConsumerIdentity: ULIDIdentity})
+	defer named.CloseConnection()
+	assert.EqualValues(t, "named", named.Config.ConsumerName)
+}
+
 // test closeConnection  must always run last
 func TestCloseConnection(t *testing.T) {
 	client.CloseConnection()
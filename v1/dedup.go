@@ -0,0 +1,105 @@
+package rediswrapper
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// ProduceDedupKeyPrefix prefixes the keys that remember idempotent produce calls
+const ProduceDedupKeyPrefix = "rsw:produce-dedup:"
+
+// idempotentXAddScript returns the ID stored under the dedup key if there is one,
+// otherwise it adds the entry and stores its ID under the key with a TTL.
+// The key is set before the XADD, so a SET that fails never leaves an entry behind, and removed if the XADD fails
+var idempotentXAddScript = redis.NewScript(`
+local existing = redis.call('GET', KEYS[1])
+if existing then
+	return {existing, 1}
+end
+redis.call('SET', KEYS[1], '', 'PX', ARGV[1])
+local id = redis.pcall('XADD', KEYS[2], '*', unpack(ARGV, 2))
+if type(id) ~= 'string' then
+	redis.call('DEL', KEYS[1])
+	if type(id) == 'table' and id.err then
+		return id
+	end
+	return redis.error_reply('ERR error adding entry to ' .. KEYS[2])
+end
+redis.call('SET', KEYS[1], id, 'PX', ARGV[1])
+return {id, 0}
+`)
+
+// ProduceMessageIdempotent produces a message unless a message with the same dedup key was produced to the stream
+// within ttl, in which case the ID of the original entry is returned and duplicate is true. The check and the XADD
+// run in one Lua script, so retrying a call that timed out can't add the entry twice.
+// In cluster mode the dedup key must hash to the stream's slot, use a hash tag in the stream name e.g. {orders}
+// it requires the following parameters:
+// streamKey: the stream key to produce the message to
+// dedupKey: identifies the message across retries, e.g. an event ID
+// payload: the message payload
+// ttl: how long the dedup key is remembered, it must be positive
+func (r *RedisStreamsClient) ProduceMessageIdempotent(ctx context.Context, streamKey string, dedupKey string, payload map[string]interface{}, ttl time.Duration) (id string, duplicate bool, err error) {
+	if dedupKey == "" {
+		return "", false, fmt.Errorf("dedup key cannot be empty")
+	}
+	if ttl <= 0 {
+		return "", false, fmt.Errorf("dedup ttl must be positive, got %v", ttl)
+	}
+	messages := []RedisStreamsMessage{{StreamName: streamKey, Properties: copyPayload(payload)}}
+	ids, err := r.produceWith(ctx, messages, func(ctx context.Context, messages []RedisStreamsMessage) ([]string, error) {
+		var result []string
+		for _, message := range messages {
+			messageID, messageDuplicate, err := r.xaddIdempotent(ctx, message, ProduceDedupKeyPrefix+streamKey+":"+dedupKey, ttl)
+			if err != nil {
+				return result, err
+			}
+			duplicate = messageDuplicate
+			result = append(result, messageID)
+		}
+		return result, nil
+	})
+	if err != nil {
+		return "", false, fmt.Errorf("error producing idempotent message: %v", err)
+	}
+	if len(ids) != 1 {
+		return "", false, fmt.Errorf("expected 1 message to be produced, got %d", len(ids))
+	}
+	return ids[0], duplicate, nil
+}
+
+func (r *RedisStreamsClient) xaddIdempotent(ctx context.Context, message RedisStreamsMessage, key string, ttl time.Duration) (string, bool, error) {
+	start := time.Now()
+	ctx, span, payload := r.startProducerSpan(ctx, message.StreamName, message.Properties)
+	args := make([]interface{}, 0, 1+2*len(payload))
+	args = append(args, ttl.Milliseconds())
+	for field, value := range payload {
+		args = append(args, field, value)
+	}
+	result, err := idempotentXAddScript.Run(ctx, r.client, []string{key, message.StreamName}, args...).Slice()
+	id, duplicate := "", false
+	if err == nil {
+		if len(result) != 2 {
+			err = fmt.Errorf("unexpected reply from idempotent produce script: %v", result)
+		} else {
+			id = fmt.Sprint(result[0])
+			duplicate = fmt.Sprint(result[1]) == "1"
+			span.SetAttributes(attribute.String("messaging.message.id", id), attribute.Bool("messaging.redis.duplicate", duplicate))
+		}
+	}
+	endSpan(span, err)
+	r.observeOperation(OperationProduce, message.StreamName, "", 1, start, err)
+	if err != nil {
+		return "", false, err
+	}
+	if duplicate {
+		log.Printf("Message with dedup key %s was already produced to stream %s as %s\n", key, message.StreamName, id)
+	} else {
+		log.Printf("Produced message %s to stream: %s\n", id, message.StreamName)
+	}
+	return id, duplicate, nil
+}
@@ -0,0 +1,85 @@
+package rediswrapper
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/a-agmon/redis-streams-wrapper/generate"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProduceMessageIdempotent(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t, "idempotent-producer")
+	stream := generate.RandomStringWithPrefix("DEDUPSTREAM")
+	payload := map[string]interface{}{"order": "A17", "amount": 250}
+
+	firstID, duplicate, err := c.ProduceMessageIdempotent(ctx, stream, "order-A17", payload, time.Minute)
+	if err != nil {
+		t.Fatalf("Error producing message: %v", err)
+	}
+	assert.False(t, duplicate)
+	// a retry returns the original entry instead of adding a new one
+	retryID, duplicate, err := c.ProduceMessageIdempotent(ctx, stream, "order-A17", payload, time.Minute)
+	if err != nil {
+		t.Fatalf("Error producing message: %v", err)
+	}
+	assert.True(t, duplicate)
+	assert.EqualValues(t, firstID, retryID)
+	otherID, duplicate, err := c.ProduceMessageIdempotent(ctx, stream, "order-A18", payload, time.Minute)
+	if err != nil {
+		t.Fatalf("Error producing message: %v", err)
+	}
+	assert.False(t, duplicate)
+	assert.NotEqual(t, firstID, otherID)
+
+	entries, err := c.client.XRange(ctx, stream, "-", "+").Result()
+	if err != nil {
+		t.Fatalf("Error reading stream: %v", err)
+	}
+	assert.EqualValues(t, 2, len(entries))
+	assert.EqualValues(t, map[string]interface{}{"order": "A17", "amount": "250"}, entries[0].Values)
+
+	// once the key expires the message can be produced again
+	testRedisServer.FastForward(2 * time.Minute)
+	_, duplicate, err = c.ProduceMessageIdempotent(ctx, stream, "order-A17", payload, time.Minute)
+	if err != nil {
+		t.Fatalf("Error producing message: %v", err)
+	}
+	assert.False(t, duplicate)
+
+	_, _, err = c.ProduceMessageIdempotent(ctx, stream, "", payload, time.Minute)
+	assert.Error(t, err)
+}
+
+func TestProduceMessageIdempotentFailuresLeaveNothingBehind(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t, "idempotent-producer")
+	stream := generate.RandomStringWithPrefix("DEDUPSTREAM")
+	payload := map[string]interface{}{"order": "A17"}
+	_, _, err := c.ProduceMessageIdempotent(ctx, stream, "order-A17", payload, 0)
+	assert.Error(t, err)
+
+	// a SET failing in the script runs before the XADD
+	key := ProduceDedupKeyPrefix + stream + ":order-A17"
+	_, err = idempotentXAddScript.Run(ctx, c.client, []string{key, stream}, 0, "order", "A17").Result()
+	assert.Error(t, err)
+	// an XADD failing removes the dedup key, so a retry can produce the message
+	_, err = idempotentXAddScript.Run(ctx, c.client, []string{key, stream}, 60000).Result()
+	assert.Error(t, err)
+	length, err := c.client.XLen(ctx, stream).Result()
+	if err != nil {
+		t.Fatalf("Error reading stream length: %v", err)
+	}
+	assert.EqualValues(t, 0, length)
+	exists, err := c.client.Exists(ctx, key).Result()
+	if err != nil {
+		t.Fatalf("Error checking dedup key: %v", err)
+	}
+	assert.EqualValues(t, 0, exists)
+
+	_, duplicate, err := c.ProduceMessageIdempotent(ctx, stream, "order-A17", payload, time.Minute)
+	assert.NoError(t, err)
+	assert.False(t, duplicate)
+}
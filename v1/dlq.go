@@ -0,0 +1,41 @@
+package rediswrapper
+
+import (
+	"context"
+	"fmt"
+	"log"
+)
+
+// Fields added to messages written to a dead letter stream
+const (
+	DeadLetterReasonField   = "dlq_reason"
+	DeadLetterStreamField   = "dlq_original_stream"
+	DeadLetterIDField       = "dlq_original_id"
+	DeadLetterGroupField    = "dlq_consumer_group"
+	DeadLetterConsumerField = "dlq_consumer"
+)
+
+// moveToDeadLetter writes a copy of the message to the dead letter stream, with the reason and its origin added as
+// fields, and acks the message in the same script, so a crash in between can't write it to the dead letter stream twice
+func (r *RedisStreamsClient) moveToDeadLetter(ctx context.Context, deadLetterStream string, msg RedisStreamsMessage, reason string) error {
+	if deadLetterStream == "" {
+		return fmt.Errorf("dead letter stream name cannot be empty")
+	}
+	_, err := r.ProduceAndAck(ctx, msg, []RedisStreamsMessage{{StreamName: deadLetterStream, Properties: deadLetterPayload(msg, reason)}})
+	if err != nil {
+		return fmt.Errorf("error moving message %s to dead letter stream %s: %v", msg.ID, deadLetterStream, err)
+	}
+	log.Printf("Moved message %s from stream %s to dead letter stream %s: %s\n", msg.ID, msg.StreamName, deadLetterStream, reason)
+	return nil
+}
+
+// deadLetterPayload returns a copy of the message fields with the reason and the origin of the message added
+func deadLetterPayload(msg RedisStreamsMessage, reason string) map[string]interface{} {
+	payload := copyPayload(msg.Properties)
+	payload[DeadLetterReasonField] = reason
+	payload[DeadLetterStreamField] = msg.StreamName
+	payload[DeadLetterIDField] = msg.ID
+	payload[DeadLetterGroupField] = msg.ConsumerGroup
+	payload[DeadLetterConsumerField] = msg.ConsumerName
+	return payload
+}
@@ -0,0 +1,211 @@
+package rediswrapper
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// StreamRange selects stream entries by ID and by the time they were added, zero values select every entry
+type StreamRange struct {
+	// Start is the first ID included, - by default
+	Start string
+	// End is the last ID included, + by default. An ID without sequence includes every entry of that millisecond
+	End string
+	// Since excludes entries added before this time
+	Since time.Time
+	// Until excludes entries added at or after this time
+	Until time.Time
+}
+
+// bounds resolves the range to the inclusive start and end IDs to pass to XRANGE
+func (s StreamRange) bounds() (string, string, error) {
+	start, end := s.Start, s.End
+	if start == "" {
+		start = "-"
+	}
+	if end == "" {
+		end = "+"
+	}
+	if end != "+" && !strings.Contains(end, "-") {
+		end = end + "-18446744073709551615"
+	}
+	if !s.Since.IsZero() {
+		since := StreamIDFromTime(s.Since)
+		if start == "-" {
+			start = since
+		} else if cmp, err := compareStreamIDs(since, start); err != nil {
+			return "", "", err
+		} else if cmp > 0 {
+			start = since
+		}
+	}
+	if !s.Until.IsZero() {
+		until := fmt.Sprintf("%d-18446744073709551615", s.Until.UnixMilli()-1)
+		if end == "+" {
+			end = until
+		} else if cmp, err := compareStreamIDs(until, end); err != nil {
+			return "", "", err
+		} else if cmp < 0 {
+			end = until
+		}
+	}
+	return start, end, nil
+}
+
+// contains reports whether an ID is within the resolved bounds
+func contains(start string, end string, id string) (bool, error) {
+	if start != "-" {
+		if cmp, err := compareStreamIDs(id, start); err != nil || cmp < 0 {
+			return false, err
+		}
+	}
+	if end != "+" {
+		if cmp, err := compareStreamIDs(id, end); err != nil || cmp > 0 {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// ExportedEntry is a stream entry as written by ExportStream, one JSON object per line
+type ExportedEntry struct {
+	ID     string                 `json:"id"`
+	Fields map[string]interface{} `json:"fields"`
+}
+
+// ExportOptions selects the entries exported by ExportStream
+type ExportOptions struct {
+	StreamRange
+	// PageSize is the number of entries read per XRANGE call, 1000 by default
+	PageSize int64
+}
+
+// ImportOptions controls how ImportStream writes entries
+type ImportOptions struct {
+	// StreamRange filters the imported entries by the IDs they had when exported
+	StreamRange
+	// PreserveIDs adds entries with their exported IDs, which fails if the stream already has a greater ID.
+	// Otherwise new IDs are generated by Redis
+	PreserveIDs bool
+	// BatchSize is the number of entries written per round trip, 1000 by default
+	BatchSize int
+}
+
+// ExportStream writes the entries of a stream to w as JSON Lines, oldest first, and returns the number of entries written
+// it requires the following parameters:
+// streamKey: the stream key to export
+// w: where the entries are written
+// opts: the range of entries to export
+func (r *RedisStreamsClient) ExportStream(ctx context.Context, streamKey string, w io.Writer, opts ExportOptions) (int, error) {
+	encoder := json.NewEncoder(w)
+	exported := 0
+	it := r.IterateRange(streamKey, opts.StreamRange, IteratorOptions{PageSize: opts.PageSize})
+	for it.Next(ctx) {
+		message := it.Message()
+		if err := encoder.Encode(ExportedEntry{ID: message.ID, Fields: message.Properties}); err != nil {
+			return exported, fmt.Errorf("error writing entry %s: %v", message.ID, err)
+		}
+		exported++
+	}
+	if err := it.Err(); err != nil {
+		return exported, fmt.Errorf("error exporting stream %s: %v", streamKey, err)
+	}
+	return exported, nil
+}
+
+// ImportStream adds the entries read from r as JSON Lines, as written by ExportStream, to a stream and returns
+// the number of entries imported. On error the count includes the entries of the failing batch that were added
+// after the failing one, and the batches after it are not sent. Entries are written as they were exported, producer interceptors and tracing don't apply
+// it requires the following parameters:
+// streamKey: the stream key to import into
+// rd: where the entries are read from
+// opts: which entries to import and whether to keep their IDs
+func (r *RedisStreamsClient) ImportStream(ctx context.Context, streamKey string, rd io.Reader, opts ImportOptions) (int, error) {
+	start, end, err := opts.bounds()
+	if err != nil {
+		return 0, fmt.Errorf("invalid import range: %v", err)
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = 1000
+	}
+	scanner := bufio.NewScanner(rd)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	imported := 0
+	batch := make([]ExportedEntry, 0, opts.BatchSize)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var entry ExportedEntry
+		if err = json.Unmarshal([]byte(text), &entry); err != nil {
+			return imported, fmt.Errorf("error decoding line %d: %v", line, err)
+		}
+		if len(entry.Fields) == 0 {
+			return imported, fmt.Errorf("entry on line %d has no fields", line)
+		}
+		if entry.ID != "" {
+			included, err := contains(start, end, entry.ID)
+			if err != nil {
+				return imported, fmt.Errorf("entry on line %d: %v", line, err)
+			}
+			if !included {
+				continue
+			}
+		}
+		batch = append(batch, entry)
+		if len(batch) == opts.BatchSize {
+			added, err := r.importBatch(ctx, streamKey, batch, opts.PreserveIDs)
+			imported += added
+			if err != nil {
+				return imported, err
+			}
+			batch = batch[:0]
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return imported, fmt.Errorf("error reading entries: %v", err)
+	}
+	added, err := r.importBatch(ctx, streamKey, batch, opts.PreserveIDs)
+	return imported + added, err
+}
+
+// importBatch adds entries with a pipeline and returns how many were added along with the first failure.
+// The pipeline goes on after a failing XADD, so entries after it may have been added as well
+func (r *RedisStreamsClient) importBatch(ctx context.Context, streamKey string, entries []ExportedEntry, preserveIDs bool) (int, error) {
+	if len(entries) == 0 {
+		return 0, nil
+	}
+	start := time.Now()
+	pipe := r.client.Pipeline()
+	cmds := make([]*redis.StringCmd, len(entries))
+	for i, entry := range entries {
+		args := &redis.XAddArgs{Stream: streamKey, Values: entry.Fields}
+		if preserveIDs {
+			args.ID = entry.ID
+		}
+		cmds[i] = pipe.XAdd(ctx, args)
+	}
+	// errors are checked per command below
+	_, _ = pipe.Exec(ctx)
+	added := 0
+	var firstErr error
+	for i, cmd := range cmds {
+		if err := cmd.Err(); err != nil {
+			if firstErr == nil {
+				firstErr = fmt.Errorf("error importing entry %s: %v", entries[i].ID, err)
+			}
+			continue
+		}
+		added++
+	}
+	r.observeOperation(OperationProduce, streamKey, "", added, start, firstErr)
+	return added, firstErr
+}
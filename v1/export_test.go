@@ -0,0 +1,117 @@
+package rediswrapper
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/a-agmon/redis-streams-wrapper/generate"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+// addEntriesWithIDs adds one entry per ID with an index field
+func addEntriesWithIDs(t *testing.T, c *RedisStreamsClient, stream string, ids ...string) {
+	for i, id := range ids {
+		err := c.client.XAdd(context.Background(), &redis.XAddArgs{Stream: stream, ID: id, Values: map[string]interface{}{"index": i}}).Err()
+		if err != nil {
+			t.Fatalf("Error adding entry: %v", err)
+		}
+	}
+}
+
+func TestExportImportStream(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t, "exporter")
+	source := generate.RandomStringWithPrefix("EXPORTSTREAM")
+	addEntriesWithIDs(t, c, source, "1000-0", "1000-1", "2000-0", "3000-0")
+
+	var buf bytes.Buffer
+	exported, err := c.ExportStream(ctx, source, &buf, ExportOptions{PageSize: 3})
+	if err != nil {
+		t.Fatalf("Error exporting stream: %v", err)
+	}
+	assert.EqualValues(t, 4, exported)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.EqualValues(t, `{"id":"1000-0","fields":{"index":"0"}}`, lines[0])
+
+	preserved := generate.RandomStringWithPrefix("IMPORTSTREAM")
+	imported, err := c.ImportStream(ctx, preserved, bytes.NewReader(buf.Bytes()), ImportOptions{PreserveIDs: true, BatchSize: 3})
+	if err != nil {
+		t.Fatalf("Error importing stream: %v", err)
+	}
+	assert.EqualValues(t, 4, imported)
+	entries, err := c.client.XRange(ctx, preserved, "-", "+").Result()
+	if err != nil {
+		t.Fatalf("Error reading stream: %v", err)
+	}
+	assert.EqualValues(t, "3000-0", entries[3].ID)
+	assert.EqualValues(t, map[string]interface{}{"index": "3"}, entries[3].Values)
+
+	// importing again with the same IDs fails, since they are not greater than the last one
+	imported, err = c.ImportStream(ctx, preserved, bytes.NewReader(buf.Bytes()), ImportOptions{PreserveIDs: true})
+	assert.Error(t, err)
+	assert.EqualValues(t, 0, imported)
+
+	// entries of a batch added after a failing one are counted
+	partial := generate.RandomStringWithPrefix("IMPORTSTREAM")
+	addEntriesWithIDs(t, c, partial, "1500-0")
+	imported, err = c.ImportStream(ctx, partial, bytes.NewReader(buf.Bytes()), ImportOptions{PreserveIDs: true})
+	assert.Error(t, err)
+	assert.EqualValues(t, 2, imported)
+	length, err := c.client.XLen(ctx, partial).Result()
+	if err != nil {
+		t.Fatalf("Error reading stream length: %v", err)
+	}
+	assert.EqualValues(t, 3, length)
+
+	renumbered := generate.RandomStringWithPrefix("IMPORTSTREAM")
+	imported, err = c.ImportStream(ctx, renumbered, bytes.NewReader(buf.Bytes()), ImportOptions{StreamRange: StreamRange{Start: "1000-1", End: "2000"}})
+	if err != nil {
+		t.Fatalf("Error importing stream: %v", err)
+	}
+	assert.EqualValues(t, 2, imported)
+	entries, err = c.client.XRange(ctx, renumbered, "-", "+").Result()
+	if err != nil {
+		t.Fatalf("Error reading stream: %v", err)
+	}
+	assert.NotEqual(t, "1000-1", entries[0].ID)
+	assert.EqualValues(t, map[string]interface{}{"index": "1"}, entries[0].Values)
+}
+
+func TestExportStreamTimeRange(t *testing.T) {
+	c := newTestClient(t, "exporter")
+	stream := generate.RandomStringWithPrefix("EXPORTSTREAM")
+	addEntriesWithIDs(t, c, stream, "1000-0", "1000-1", "2000-0", "3000-0")
+	var buf bytes.Buffer
+	exported, err := c.ExportStream(context.Background(), stream, &buf, ExportOptions{
+		StreamRange: StreamRange{Since: time.UnixMilli(1000), Until: time.UnixMilli(3000)},
+	})
+	if err != nil {
+		t.Fatalf("Error exporting stream: %v", err)
+	}
+	assert.EqualValues(t, 3, exported)
+	buf.Reset()
+	exported, err = c.ExportStream(context.Background(), stream, &buf, ExportOptions{
+		StreamRange: StreamRange{Start: "1000-1", Since: time.UnixMilli(1000), End: "2000-0"},
+	})
+	if err != nil {
+		t.Fatalf("Error exporting stream: %v", err)
+	}
+	assert.EqualValues(t, 2, exported)
+}
+
+func TestStreamRangeBounds(t *testing.T) {
+	start, end, err := StreamRange{}.bounds()
+	assert.NoError(t, err)
+	assert.EqualValues(t, "-", start)
+	assert.EqualValues(t, "+", end)
+	start, end, err = StreamRange{Start: "500-0", End: "9000", Since: time.UnixMilli(1000), Until: time.UnixMilli(2000)}.bounds()
+	assert.NoError(t, err)
+	assert.EqualValues(t, "1000-0", start)
+	assert.EqualValues(t, "1999-18446744073709551615", end)
+	_, _, err = StreamRange{Start: "abc", Since: time.UnixMilli(1000)}.bounds()
+	assert.Error(t, err)
+}
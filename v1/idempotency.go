@@ -0,0 +1,227 @@
+package rediswrapper
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ReserveResult is the outcome of reserving an idempotency key before handling a message
+type ReserveResult int
+
+const (
+	// Reserved means the message was not processed yet and this consumer may handle it
+	Reserved ReserveResult = iota
+	// AlreadyProcessed means a message with the same key was handled successfully before
+	AlreadyProcessed
+	// InProgress means a message with the same key is being handled by another consumer right now
+	InProgress
+)
+
+// IdempotencyStore remembers which messages were processed, so redelivered duplicates can be skipped
+type IdempotencyStore interface {
+	// Reserve marks key as being processed unless it was already processed or is in progress
+	Reserve(ctx context.Context, key string) (ReserveResult, error)
+	// Complete marks key as processed and acks the message, atomically if the store supports it
+	Complete(ctx context.Context, key string, msg RedisStreamsMessage) error
+	// Release drops a reservation after the handler failed, so the message can be retried
+	Release(ctx context.Context, key string) error
+}
+
+// IdempotencyConfig enables idempotent consumption for a Subscription when Store is set
+type IdempotencyConfig struct {
+	Store IdempotencyStore
+	// KeyField is the payload field holding the idempotency key. When empty, or missing from a message,
+	// the message ID is used
+	KeyField string
+}
+
+// idempotencyKey returns the key of a message, scoped to its stream and group since every group processes messages independently
+func (c IdempotencyConfig) idempotencyKey(msg RedisStreamsMessage) string {
+	key := msg.ID
+	if c.KeyField != "" {
+		if value := payloadString(msg.Properties, c.KeyField); value != "" {
+			key = value
+		}
+	}
+	return msg.StreamName + ":" + msg.ConsumerGroup + ":" + key
+}
+
+// reserveScript sets the key as processing if it does not exist, otherwise it reports whether it is done or in progress
+var reserveScript = redis.NewScript(`
+if redis.call('SET', KEYS[1], 'processing', 'NX', 'PX', ARGV[1]) then
+	return 0
+end
+if redis.call('GET', KEYS[1]) == 'done' then
+	return 1
+end
+return 2
+`)
+
+// completeScript marks the key as done and acks the message in one step, so a crash can't leave one without the other
+var completeScript = redis.NewScript(`
+redis.call('SET', KEYS[1], 'done', 'PX', ARGV[1])
+return redis.call('XACK', KEYS[2], ARGV[2], ARGV[3])
+`)
+
+// Defaults of the idempotency stores
+const (
+	defaultIdempotencyTTL            = 24 * time.Hour
+	defaultProcessingTTL             = 5 * time.Minute
+	defaultMemoryIdempotencyCapacity = 10000
+)
+
+// RedisIdempotencyStore keeps idempotency keys in Redis with SET NX and a TTL, and acks messages with a Lua script
+// that records completion in the same step. In cluster mode the keys must hash to the slot of the stream,
+// e.g. by using a hash tag in both the stream name and the prefix
+type RedisIdempotencyStore struct {
+	client        *RedisStreamsClient
+	prefix        string
+	ttl           time.Duration
+	processingTTL time.Duration
+}
+
+// NewRedisIdempotencyStore creates a RedisIdempotencyStore
+// it requires the following parameters:
+// prefix: prepended to every idempotency key
+// ttl: how long processed keys are remembered, 24 hours when not positive
+// processingTTL: how long a reservation lasts if the consumer dies while handling the message, 5 minutes when not positive
+func (r *RedisStreamsClient) NewRedisIdempotencyStore(prefix string, ttl time.Duration, processingTTL time.Duration) *RedisIdempotencyStore {
+	// a TTL of 0 would make every SET PX fail, so no message could ever be handled or acked
+	if ttl <= 0 {
+		ttl = defaultIdempotencyTTL
+	}
+	if processingTTL <= 0 {
+		processingTTL = defaultProcessingTTL
+	}
+	return &RedisIdempotencyStore{
+		client:        r,
+		prefix:        prefix,
+		ttl:           ttl,
+		processingTTL: processingTTL,
+	}
+}
+
+// Reserve implements IdempotencyStore
+func (s *RedisIdempotencyStore) Reserve(ctx context.Context, key string) (ReserveResult, error) {
+	result, err := reserveScript.Run(ctx, s.client.client, []string{s.prefix + key}, s.processingTTL.Milliseconds()).Int()
+	if err != nil {
+		return Reserved, fmt.Errorf("error reserving idempotency key %s: %v", key, err)
+	}
+	return ReserveResult(result), nil
+}
+
+// Complete implements IdempotencyStore
+func (s *RedisIdempotencyStore) Complete(ctx context.Context, key string, msg RedisStreamsMessage) error {
+	err := completeScript.Run(ctx, s.client.client, []string{s.prefix + key, msg.StreamName},
+		s.ttl.Milliseconds(), msg.ConsumerGroup, msg.ID).Err()
+	if err != nil {
+		return fmt.Errorf("error completing idempotency key %s: %v", key, err)
+	}
+	return nil
+}
+
+// Release implements IdempotencyStore
+func (s *RedisIdempotencyStore) Release(ctx context.Context, key string) error {
+	err := s.client.client.Del(ctx, s.prefix+key).Err()
+	if err != nil {
+		return fmt.Errorf("error releasing idempotency key %s: %v", key, err)
+	}
+	return nil
+}
+
+// MemoryIdempotencyStore keeps idempotency keys in a process local LRU. It only protects against duplicates
+// seen by the same process, and marks keys as processed after the ack rather than atomically with it
+type MemoryIdempotencyStore struct {
+	client   *RedisStreamsClient
+	capacity int
+	ttl      time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	lru     *list.List
+}
+
+type memoryIdempotencyEntry struct {
+	key     string
+	done    bool
+	expires time.Time
+}
+
+// NewMemoryIdempotencyStore creates a MemoryIdempotencyStore holding at most capacity keys for ttl each.
+// capacity defaults to 10000 and ttl to 24 hours when not positive
+func (r *RedisStreamsClient) NewMemoryIdempotencyStore(capacity int, ttl time.Duration) *MemoryIdempotencyStore {
+	if capacity <= 0 {
+		capacity = defaultMemoryIdempotencyCapacity
+	}
+	if ttl <= 0 {
+		ttl = defaultIdempotencyTTL
+	}
+	return &MemoryIdempotencyStore{
+		client:   r,
+		capacity: capacity,
+		ttl:      ttl,
+		entries:  make(map[string]*list.Element),
+		lru:      list.New(),
+	}
+}
+
+// Reserve implements IdempotencyStore
+func (s *MemoryIdempotencyStore) Reserve(ctx context.Context, key string) (ReserveResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if element, ok := s.entries[key]; ok {
+		entry := element.Value.(*memoryIdempotencyEntry)
+		if time.Now().Before(entry.expires) {
+			s.lru.MoveToFront(element)
+			if entry.done {
+				return AlreadyProcessed, nil
+			}
+			return InProgress, nil
+		}
+		s.remove(element)
+	}
+	s.set(key, false)
+	return Reserved, nil
+}
+
+// Complete implements IdempotencyStore
+func (s *MemoryIdempotencyStore) Complete(ctx context.Context, key string, msg RedisStreamsMessage) error {
+	err := s.client.AckMessage(ctx, msg.StreamName, msg.ConsumerGroup, msg.ID)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if element, ok := s.entries[key]; ok {
+		s.remove(element)
+	}
+	s.set(key, true)
+	return nil
+}
+
+// Release implements IdempotencyStore
+func (s *MemoryIdempotencyStore) Release(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if element, ok := s.entries[key]; ok {
+		s.remove(element)
+	}
+	return nil
+}
+
+func (s *MemoryIdempotencyStore) set(key string, done bool) {
+	s.entries[key] = s.lru.PushFront(&memoryIdempotencyEntry{key: key, done: done, expires: time.Now().Add(s.ttl)})
+	for s.capacity > 0 && s.lru.Len() > s.capacity {
+		s.remove(s.lru.Back())
+	}
+}
+
+func (s *MemoryIdempotencyStore) remove(element *list.Element) {
+	s.lru.Remove(element)
+	delete(s.entries, element.Value.(*memoryIdempotencyEntry).key)
+}
@@ -0,0 +1,129 @@
+package rediswrapper
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/a-agmon/redis-streams-wrapper/generate"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubscriptionSkipsDuplicates(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t, "idempotent-consumer")
+	stores := map[string]IdempotencyStore{
+		"redis":  c.NewRedisIdempotencyStore("idempotency:", time.Hour, time.Minute),
+		"memory": c.NewMemoryIdempotencyStore(100, time.Hour),
+	}
+	for name, store := range stores {
+		t.Run(name, func(t *testing.T) {
+			stream := generate.RandomStringWithPrefix("IDEMSTREAM")
+			group := generate.RandomStringWithPrefix("IDEMGROUP")
+			for _, eventID := range []string{"order-1", "order-2", "order-1"} {
+				err := c.ProduceMessage(ctx, stream, map[string]interface{}{"event_id": eventID})
+				if err != nil {
+					t.Fatalf("Error producing message: %v", err)
+				}
+			}
+			subCtx, cancel := context.WithCancel(ctx)
+			defer cancel()
+			handled := make([]string, 0)
+			sub := c.Subscribe(SubscriptionConfig{
+				StreamName:     stream,
+				ConsumerGroup:  group,
+				WaitForSeconds: 1,
+				Idempotency:    IdempotencyConfig{Store: store, KeyField: "event_id"},
+			}, func(ctx context.Context, msg RedisStreamsMessage) error {
+				handled = append(handled, msg.Properties["event_id"].(string))
+				return nil
+			})
+			done := make(chan error, 1)
+			go func() {
+				done <- sub.Run(subCtx)
+			}()
+			assert.Eventually(t, func() bool { return sub.Stats().Duplicates == 1 }, 5*time.Second, 10*time.Millisecond)
+			cancel()
+			err := <-done
+			if err != nil {
+				t.Fatalf("Error running subscription: %v", err)
+			}
+			assert.EqualValues(t, []string{"order-1", "order-2"}, handled)
+			assert.EqualValues(t, 1, sub.Stats().Duplicates)
+			pending, err := c.client.XPending(ctx, stream, group).Result()
+			if err != nil {
+				t.Fatalf("Error fetching pending summary: %v", err)
+			}
+			assert.EqualValues(t, 0, pending.Count)
+		})
+	}
+}
+
+func TestRedisIdempotencyStoreReservations(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t, "idempotent-consumer")
+	store := c.NewRedisIdempotencyStore(generate.RandomStringWithPrefix("idempotency")+":", time.Hour, time.Minute)
+	result, err := store.Reserve(ctx, "key")
+	assert.NoError(t, err)
+	assert.EqualValues(t, Reserved, result)
+	result, err = store.Reserve(ctx, "key")
+	assert.NoError(t, err)
+	assert.EqualValues(t, InProgress, result)
+	// a failed handler releases the key so a retry can reserve it again
+	assert.NoError(t, store.Release(ctx, "key"))
+	result, err = store.Reserve(ctx, "key")
+	assert.NoError(t, err)
+	assert.EqualValues(t, Reserved, result)
+}
+
+func TestMemoryIdempotencyStoreEviction(t *testing.T) {
+	ctx := context.Background()
+	store := (&RedisStreamsClient{}).NewMemoryIdempotencyStore(2, time.Hour)
+	for _, key := range []string{"a", "b", "c"} {
+		result, err := store.Reserve(ctx, key)
+		assert.NoError(t, err)
+		assert.EqualValues(t, Reserved, result)
+	}
+	// "a" was evicted as the least recently used key
+	result, _ := store.Reserve(ctx, "a")
+	assert.EqualValues(t, Reserved, result)
+	result, _ = store.Reserve(ctx, "c")
+	assert.EqualValues(t, InProgress, result)
+
+	expiring := (&RedisStreamsClient{}).NewMemoryIdempotencyStore(10, time.Millisecond)
+	_, _ = expiring.Reserve(ctx, "a")
+	time.Sleep(5 * time.Millisecond)
+	result, _ = expiring.Reserve(ctx, "a")
+	assert.EqualValues(t, Reserved, result)
+}
+
+func TestIdempotencyStoresDefaultNonPositiveTTLs(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t, "idempotent-consumer")
+	prefix := generate.RandomStringWithPrefix("idempotency") + ":"
+	stream := generate.RandomStringWithPrefix("IDEMSTREAM")
+	group := generate.RandomStringWithPrefix("IDEMGROUP")
+	messages := fetchPending(t, c, stream, group, 1)
+
+	store := c.NewRedisIdempotencyStore(prefix, 0, -time.Second)
+	result, err := store.Reserve(ctx, "key")
+	assert.NoError(t, err)
+	assert.EqualValues(t, Reserved, result)
+	ttl, err := c.client.PTTL(ctx, prefix+"key").Result()
+	assert.NoError(t, err)
+	assert.EqualValues(t, defaultProcessingTTL, ttl)
+	assert.NoError(t, store.Complete(ctx, "key", messages[0]))
+	ttl, err = c.client.PTTL(ctx, prefix+"key").Result()
+	assert.NoError(t, err)
+	assert.EqualValues(t, defaultIdempotencyTTL, ttl)
+	result, err = store.Reserve(ctx, "key")
+	assert.NoError(t, err)
+	assert.EqualValues(t, AlreadyProcessed, result)
+
+	memory := c.NewMemoryIdempotencyStore(0, 0)
+	result, _ = memory.Reserve(ctx, "key")
+	assert.EqualValues(t, Reserved, result)
+	assert.NoError(t, memory.Complete(ctx, "key", messages[0]))
+	result, _ = memory.Reserve(ctx, "key")
+	assert.EqualValues(t, AlreadyProcessed, result)
+}
@@ -0,0 +1,88 @@
+package rediswrapper
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseStreamID splits a stream entry ID of the form <milliseconds>-<sequence> into its parts
+func parseStreamID(id string) (uint64, uint64, error) {
+	parts := strings.SplitN(id, "-", 2)
+	ms, err := strconv.ParseUint(parts[0], 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid stream ID %s", id)
+	}
+	if len(parts) == 1 {
+		return ms, 0, nil
+	}
+	seq, err := strconv.ParseUint(parts[1], 10, 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid stream ID %s", id)
+	}
+	return ms, seq, nil
+}
+
+// StreamIDTime returns the time an entry was added to the stream, as encoded in the first part of its ID
+func StreamIDTime(id string) (time.Time, error) {
+	ms, _, err := parseStreamID(id)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return time.UnixMilli(int64(ms)), nil
+}
+
+// StreamIDFromTime returns the smallest stream ID that could have been added at the given time
+func StreamIDFromTime(t time.Time) string {
+	return fmt.Sprintf("%d-0", t.UnixMilli())
+}
+
+// nextStreamID returns the smallest ID greater than the given one, used to build exclusive ranges
+// without relying on the "(" syntax that needs Redis 6.2
+func nextStreamID(id string) (string, error) {
+	ms, seq, err := parseStreamID(id)
+	if err != nil {
+		return "", err
+	}
+	if seq == ^uint64(0) {
+		return fmt.Sprintf("%d-0", ms+1), nil
+	}
+	return fmt.Sprintf("%d-%d", ms, seq+1), nil
+}
+
+// compareStreamIDs returns -1, 0 or 1 when a is smaller than, equal to or greater than b
+func compareStreamIDs(a string, b string) (int, error) {
+	aMs, aSeq, err := parseStreamID(a)
+	if err != nil {
+		return 0, err
+	}
+	bMs, bSeq, err := parseStreamID(b)
+	if err != nil {
+		return 0, err
+	}
+	switch {
+	case aMs < bMs || (aMs == bMs && aSeq < bSeq):
+		return -1, nil
+	case aMs == bMs && aSeq == bSeq:
+		return 0, nil
+	default:
+		return 1, nil
+	}
+}
+
+// prevStreamID returns the greatest ID smaller than the given one, ok is false for 0-0 which has none
+func prevStreamID(id string) (string, bool, error) {
+	ms, seq, err := parseStreamID(id)
+	if err != nil {
+		return "", false, err
+	}
+	switch {
+	case seq > 0:
+		return fmt.Sprintf("%d-%d", ms, seq-1), true, nil
+	case ms > 0:
+		return fmt.Sprintf("%d-%d", ms-1, ^uint64(0)), true, nil
+	default:
+		return "", false, nil
+	}
+}
@@ -0,0 +1,44 @@
+package rediswrapper
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStreamIDs(t *testing.T) {
+	ts, err := StreamIDTime("1682668974176-3")
+	if err != nil {
+		t.Fatalf("Error parsing stream ID: %v", err)
+	}
+	assert.EqualValues(t, time.UnixMilli(1682668974176), ts)
+	assert.EqualValues(t, "1682668974176-0", StreamIDFromTime(ts))
+
+	next, err := nextStreamID("1682668974176-3")
+	if err != nil {
+		t.Fatalf("Error computing next stream ID: %v", err)
+	}
+	assert.EqualValues(t, "1682668974176-4", next)
+	next, err = nextStreamID("1682668974176-18446744073709551615")
+	if err != nil {
+		t.Fatalf("Error computing next stream ID: %v", err)
+	}
+	assert.EqualValues(t, "1682668974177-0", next)
+	prev, ok, err := prevStreamID("1682668974177-0")
+	if err != nil {
+		t.Fatalf("Error computing previous stream ID: %v", err)
+	}
+	assert.True(t, ok)
+	assert.EqualValues(t, "1682668974176-18446744073709551615", prev)
+	_, ok, _ = prevStreamID("0-0")
+	assert.False(t, ok)
+	cmp, err := compareStreamIDs("1682668974176-3", "1682668974176-10")
+	if err != nil {
+		t.Fatalf("Error comparing stream IDs: %v", err)
+	}
+	assert.EqualValues(t, -1, cmp)
+
+	_, err = StreamIDTime("not-an-id")
+	assert.Error(t, err)
+}
@@ -0,0 +1,246 @@
+package rediswrapper
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// StreamInfo describes a stream as reported by XINFO STREAM
+type StreamInfo struct {
+	Length               int64
+	RadixTreeKeys        int64
+	RadixTreeNodes       int64
+	Groups               int64
+	LastGeneratedID      string
+	MaxDeletedEntryID    string
+	RecordedFirstEntryID string
+	EntriesAdded         int64
+	// FirstEntry and LastEntry are nil when the stream is empty
+	FirstEntry *RedisStreamsMessage
+	LastEntry  *RedisStreamsMessage
+}
+
+// GroupInfo describes a consumer group as reported by XINFO GROUPS
+type GroupInfo struct {
+	Name            string
+	Consumers       int64
+	Pending         int64
+	LastDeliveredID string
+	EntriesRead     int64
+	// Lag is the number of entries not yet delivered to the group, Redis reports it as 0 when it can't be determined
+	Lag int64
+}
+
+// ConsumerInfo describes a consumer of a group as reported by XINFO CONSUMERS
+type ConsumerInfo struct {
+	Name    string
+	Pending int64
+	// Idle is the time since the consumer last attempted an interaction (read, claim)
+	Idle time.Duration
+	// Inactive is the time since the consumer last had a successful interaction, only reported by Redis 7.2+
+	Inactive time.Duration
+}
+
+// PendingEntryInfo describes an entry in a pending entries list as reported by XINFO STREAM FULL
+type PendingEntryInfo struct {
+	ID            string
+	Consumer      string
+	DeliveryTime  time.Time
+	DeliveryCount int64
+}
+
+// ConsumerInfoFull describes a consumer as reported by XINFO STREAM FULL
+type ConsumerInfoFull struct {
+	Name       string
+	SeenTime   time.Time
+	ActiveTime time.Time
+	PelCount   int64
+	Pending    []PendingEntryInfo
+}
+
+// GroupInfoFull describes a consumer group as reported by XINFO STREAM FULL
+type GroupInfoFull struct {
+	Name            string
+	LastDeliveredID string
+	EntriesRead     int64
+	Lag             int64
+	PelCount        int64
+	Pending         []PendingEntryInfo
+	Consumers       []ConsumerInfoFull
+}
+
+// StreamInfoFull is the detailed description of a stream, its entries, groups and consumers as reported by XINFO STREAM FULL
+type StreamInfoFull struct {
+	Length               int64
+	RadixTreeKeys        int64
+	RadixTreeNodes       int64
+	LastGeneratedID      string
+	MaxDeletedEntryID    string
+	RecordedFirstEntryID string
+	EntriesAdded         int64
+	Entries              []RedisStreamsMessage
+	Groups               []GroupInfoFull
+}
+
+// StreamInfo returns general information about a stream
+// it requires the following parameters:
+// streamKey: the stream key to inspect
+func (r *RedisStreamsClient) StreamInfo(ctx context.Context, streamKey string) (*StreamInfo, error) {
+	info, err := r.client.XInfoStream(ctx, streamKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error fetching info of stream %s: %v", streamKey, err)
+	}
+	streamInfo := &StreamInfo{
+		Length:               info.Length,
+		RadixTreeKeys:        info.RadixTreeKeys,
+		RadixTreeNodes:       info.RadixTreeNodes,
+		Groups:               info.Groups,
+		LastGeneratedID:      info.LastGeneratedID,
+		MaxDeletedEntryID:    info.MaxDeletedEntryID,
+		RecordedFirstEntryID: info.RecordedFirstEntryID,
+		EntriesAdded:         info.EntriesAdded,
+	}
+	if info.FirstEntry.ID != "" {
+		firstEntry := r.streamMessage(streamKey, &info.FirstEntry)
+		streamInfo.FirstEntry = &firstEntry
+	}
+	if info.LastEntry.ID != "" {
+		lastEntry := r.streamMessage(streamKey, &info.LastEntry)
+		streamInfo.LastEntry = &lastEntry
+	}
+	return streamInfo, nil
+}
+
+// StreamInfoFull returns the full state of a stream including its entries, groups, consumers and pending entries
+// it requires the following parameters:
+// streamKey: the stream key to inspect
+// count: the maximum number of entries and pending entries returned per list, use 0 for the Redis default (10)
+func (r *RedisStreamsClient) StreamInfoFull(ctx context.Context, streamKey string, count int) (*StreamInfoFull, error) {
+	info, err := r.client.XInfoStreamFull(ctx, streamKey, count).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error fetching full info of stream %s: %v", streamKey, err)
+	}
+	streamInfo := &StreamInfoFull{
+		Length:               info.Length,
+		RadixTreeKeys:        info.RadixTreeKeys,
+		RadixTreeNodes:       info.RadixTreeNodes,
+		LastGeneratedID:      info.LastGeneratedID,
+		MaxDeletedEntryID:    info.MaxDeletedEntryID,
+		RecordedFirstEntryID: info.RecordedFirstEntryID,
+		EntriesAdded:         info.EntriesAdded,
+		Entries:              make([]RedisStreamsMessage, 0, len(info.Entries)),
+		Groups:               make([]GroupInfoFull, 0, len(info.Groups)),
+	}
+	for i := range info.Entries {
+		streamInfo.Entries = append(streamInfo.Entries, r.streamMessage(streamKey, &info.Entries[i]))
+	}
+	for _, group := range info.Groups {
+		groupInfo := GroupInfoFull{
+			Name:            group.Name,
+			LastDeliveredID: group.LastDeliveredID,
+			EntriesRead:     group.EntriesRead,
+			Lag:             group.Lag,
+			PelCount:        group.PelCount,
+			Pending:         make([]PendingEntryInfo, 0, len(group.Pending)),
+			Consumers:       make([]ConsumerInfoFull, 0, len(group.Consumers)),
+		}
+		for _, pending := range group.Pending {
+			groupInfo.Pending = append(groupInfo.Pending, PendingEntryInfo{
+				ID:            pending.ID,
+				Consumer:      pending.Consumer,
+				DeliveryTime:  pending.DeliveryTime,
+				DeliveryCount: pending.DeliveryCount,
+			})
+		}
+		for _, consumer := range group.Consumers {
+			consumerInfo := ConsumerInfoFull{
+				Name:       consumer.Name,
+				SeenTime:   consumer.SeenTime,
+				ActiveTime: consumer.ActiveTime,
+				PelCount:   consumer.PelCount,
+				Pending:    make([]PendingEntryInfo, 0, len(consumer.Pending)),
+			}
+			for _, pending := range consumer.Pending {
+				consumerInfo.Pending = append(consumerInfo.Pending, PendingEntryInfo{
+					ID:            pending.ID,
+					Consumer:      consumer.Name,
+					DeliveryTime:  pending.DeliveryTime,
+					DeliveryCount: pending.DeliveryCount,
+				})
+			}
+			groupInfo.Consumers = append(groupInfo.Consumers, consumerInfo)
+		}
+		streamInfo.Groups = append(streamInfo.Groups, groupInfo)
+	}
+	return streamInfo, nil
+}
+
+// GroupsInfo returns information about every consumer group of a stream
+// it requires the following parameters:
+// streamKey: the stream key to inspect
+func (r *RedisStreamsClient) GroupsInfo(ctx context.Context, streamKey string) ([]GroupInfo, error) {
+	groups, err := r.client.XInfoGroups(ctx, streamKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error fetching groups of stream %s: %v", streamKey, err)
+	}
+	groupsInfo := make([]GroupInfo, 0, len(groups))
+	for _, group := range groups {
+		groupsInfo = append(groupsInfo, GroupInfo{
+			Name:            group.Name,
+			Consumers:       group.Consumers,
+			Pending:         group.Pending,
+			LastDeliveredID: group.LastDeliveredID,
+			EntriesRead:     group.EntriesRead,
+			Lag:             group.Lag,
+		})
+	}
+	return groupsInfo, nil
+}
+
+// GroupInfo returns information about a single consumer group, or an error if the group does not exist
+// it requires the following parameters:
+// streamKey: the stream key of the consumer group
+// consumerGroup: the consumer group to inspect
+func (r *RedisStreamsClient) GroupInfo(ctx context.Context, streamKey string, consumerGroup string) (*GroupInfo, error) {
+	groups, err := r.GroupsInfo(ctx, streamKey)
+	if err != nil {
+		return nil, err
+	}
+	for i := range groups {
+		if groups[i].Name == consumerGroup {
+			return &groups[i], nil
+		}
+	}
+	return nil, fmt.Errorf("consumer group %s does not exist on stream %s", consumerGroup, streamKey)
+}
+
+// ConsumersInfo returns information about every consumer of a consumer group
+// it requires the following parameters:
+// streamKey: the stream key of the consumer group
+// consumerGroup: the consumer group to inspect
+func (r *RedisStreamsClient) ConsumersInfo(ctx context.Context, streamKey string, consumerGroup string) ([]ConsumerInfo, error) {
+	consumers, err := r.client.XInfoConsumers(ctx, streamKey, consumerGroup).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error fetching consumers of group %s on stream %s: %v", consumerGroup, streamKey, err)
+	}
+	consumersInfo := make([]ConsumerInfo, 0, len(consumers))
+	for _, consumer := range consumers {
+		consumersInfo = append(consumersInfo, ConsumerInfo{
+			Name:     consumer.Name,
+			Pending:  consumer.Pending,
+			Idle:     consumer.Idle,
+			Inactive: consumer.Inactive,
+		})
+	}
+	return consumersInfo, nil
+}
+
+// streamMessage converts a redis.XMessage read outside of a consumer group to a RedisStreamsMessage
+func (r *RedisStreamsClient) streamMessage(streamKey string, xMessage *redis.XMessage) RedisStreamsMessage {
+	message := r.transformXMessageToRedisStreamsMessage(xMessage)
+	message.StreamName = streamKey
+	return message
+}
@@ -0,0 +1,180 @@
+package rediswrapper
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/a-agmon/redis-streams-wrapper/generate"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInspectStreamGroupsAndConsumers(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t, "info-consumer")
+	stream := generate.RandomStringWithPrefix("INFOSTREAM")
+	group := generate.RandomStringWithPrefix("INFOGROUP")
+	produceMessagesTo(t, c, stream, 4)
+	_, err := c.FetchNewMessages(ctx, stream, group, 3, 1)
+	if err != nil {
+		t.Fatalf("Error polling for new messages: %v", err)
+	}
+
+	streamInfo, err := c.StreamInfo(ctx, stream)
+	if err != nil {
+		t.Fatalf("Error fetching stream info: %v", err)
+	}
+	assert.EqualValues(t, 4, streamInfo.Length)
+
+	groups, err := c.GroupsInfo(ctx, stream)
+	if err != nil {
+		t.Fatalf("Error fetching groups info: %v", err)
+	}
+	assert.EqualValues(t, 1, len(groups))
+	assert.EqualValues(t, group, groups[0].Name)
+	assert.EqualValues(t, 1, groups[0].Consumers)
+	assert.EqualValues(t, 3, groups[0].Pending)
+
+	groupInfo, err := c.GroupInfo(ctx, stream, group)
+	if err != nil {
+		t.Fatalf("Error fetching group info: %v", err)
+	}
+	assert.EqualValues(t, groups[0], *groupInfo)
+	_, err = c.GroupInfo(ctx, stream, "no-such-group")
+	assert.Error(t, err)
+
+	consumers, err := c.ConsumersInfo(ctx, stream, group)
+	if err != nil {
+		t.Fatalf("Error fetching consumers info: %v", err)
+	}
+	// miniredis reports neither idle nor inactive times, only the fields it populates are checked
+	assert.EqualValues(t, 1, len(consumers))
+	assert.EqualValues(t, "info-consumer", consumers[0].Name)
+	assert.EqualValues(t, 3, consumers[0].Pending)
+
+	_, err = c.StreamInfo(ctx, generate.RandomStringWithPrefix("MISSINGSTREAM"))
+	assert.Error(t, err)
+}
+
+// infoReplyHook answers XINFO STREAM and XINFO STREAM FULL with canned replies, as miniredis only reports the length
+type infoReplyHook struct {
+	stream *redis.XInfoStream
+	full   *redis.XInfoStreamFull
+}
+
+func (h *infoReplyHook) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return next(ctx, network, addr)
+	}
+}
+
+func (h *infoReplyHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		switch infoCmd := cmd.(type) {
+		case *redis.XInfoStreamCmd:
+			infoCmd.SetVal(h.stream)
+			return nil
+		case *redis.XInfoStreamFullCmd:
+			infoCmd.SetVal(h.full)
+			return nil
+		}
+		return next(ctx, cmd)
+	}
+}
+
+func (h *infoReplyHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return next
+}
+
+func TestStreamInfoEntries(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t, "info-consumer")
+	c.client.AddHook(&infoReplyHook{stream: &redis.XInfoStream{
+		Length:          2,
+		LastGeneratedID: "2000-0",
+		EntriesAdded:    2,
+		FirstEntry:      redis.XMessage{ID: "1000-0", Values: map[string]interface{}{"book": "Dune"}},
+		LastEntry:       redis.XMessage{ID: "2000-0", Values: map[string]interface{}{"book": "Emma"}},
+	}})
+	info, err := c.StreamInfo(ctx, "books")
+	if err != nil {
+		t.Fatalf("Error fetching stream info: %v", err)
+	}
+	assert.EqualValues(t, 2, info.Length)
+	assert.EqualValues(t, "2000-0", info.LastGeneratedID)
+	assert.EqualValues(t, 2, info.EntriesAdded)
+	assert.EqualValues(t, &RedisStreamsMessage{ID: "1000-0", StreamName: "books", Properties: map[string]interface{}{"book": "Dune"}}, info.FirstEntry)
+	assert.EqualValues(t, &RedisStreamsMessage{ID: "2000-0", StreamName: "books", Properties: map[string]interface{}{"book": "Emma"}}, info.LastEntry)
+
+	// an empty stream has no first and last entries
+	c = newTestClient(t, "info-consumer")
+	c.client.AddHook(&infoReplyHook{stream: &redis.XInfoStream{}})
+	info, err = c.StreamInfo(ctx, "books")
+	if err != nil {
+		t.Fatalf("Error fetching stream info: %v", err)
+	}
+	assert.Nil(t, info.FirstEntry)
+	assert.Nil(t, info.LastEntry)
+}
+
+func TestStreamInfoFull(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t, "info-consumer")
+	delivered := time.UnixMilli(1500)
+	seen := time.UnixMilli(1600)
+	c.client.AddHook(&infoReplyHook{full: &redis.XInfoStreamFull{
+		Length:          2,
+		LastGeneratedID: "2000-0",
+		EntriesAdded:    2,
+		Entries: []redis.XMessage{
+			{ID: "1000-0", Values: map[string]interface{}{"book": "Dune"}},
+			{ID: "2000-0", Values: map[string]interface{}{"book": "Emma"}},
+		},
+		Groups: []redis.XInfoStreamGroup{{
+			Name:            "readers",
+			LastDeliveredID: "1000-0",
+			EntriesRead:     1,
+			Lag:             1,
+			PelCount:        1,
+			Pending:         []redis.XInfoStreamGroupPending{{ID: "1000-0", Consumer: "reader-1", DeliveryTime: delivered, DeliveryCount: 2}},
+			Consumers: []redis.XInfoStreamConsumer{{
+				Name:       "reader-1",
+				SeenTime:   seen,
+				ActiveTime: seen,
+				PelCount:   1,
+				Pending:    []redis.XInfoStreamConsumerPending{{ID: "1000-0", DeliveryTime: delivered, DeliveryCount: 2}},
+			}},
+		}},
+	}})
+	info, err := c.StreamInfoFull(ctx, "books", 0)
+	if err != nil {
+		t.Fatalf("Error fetching full stream info: %v", err)
+	}
+	pending := PendingEntryInfo{ID: "1000-0", Consumer: "reader-1", DeliveryTime: delivered, DeliveryCount: 2}
+	assert.EqualValues(t, &StreamInfoFull{
+		Length:          2,
+		LastGeneratedID: "2000-0",
+		EntriesAdded:    2,
+		Entries: []RedisStreamsMessage{
+			{ID: "1000-0", StreamName: "books", Properties: map[string]interface{}{"book": "Dune"}},
+			{ID: "2000-0", StreamName: "books", Properties: map[string]interface{}{"book": "Emma"}},
+		},
+		Groups: []GroupInfoFull{{
+			Name:            "readers",
+			LastDeliveredID: "1000-0",
+			EntriesRead:     1,
+			Lag:             1,
+			PelCount:        1,
+			Pending:         []PendingEntryInfo{pending},
+			Consumers: []ConsumerInfoFull{{
+				Name:       "reader-1",
+				SeenTime:   seen,
+				ActiveTime: seen,
+				PelCount:   1,
+				Pending:    []PendingEntryInfo{pending},
+			}},
+		}},
+	}, info)
+}
@@ -0,0 +1,172 @@
+package rediswrapper
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+)
+
+// lagPageSize is the number of entries read per XRANGE call when paging through a stream
+const lagPageSize = 1000
+
+// lagScanLimit is the most undelivered entries counted when Redis does not report the lag of a group
+const lagScanLimit = 1000
+
+// GroupLag describes how far behind a consumer group is on its stream
+type GroupLag struct {
+	StreamName    string
+	ConsumerGroup string
+	// EntriesBehind is the number of entries in the stream that were not yet delivered to the group.
+	// When EntriesBehindCapped is set the group is further behind, and this is only a lower bound
+	EntriesBehind       int64
+	EntriesBehindCapped bool
+	// TimeBehind is the age of the oldest undelivered entry, computed from its ID, or zero when the group is up to date
+	TimeBehind time.Duration
+	// Pending is the number of entries delivered to the group but not yet acked
+	Pending         int64
+	LastDeliveredID string
+	LastEntryID     string
+}
+
+// Lag reports how far behind a consumer group is.
+// Entries behind are taken from the lag reported by XINFO GROUPS (Redis 7+) when Redis could determine it.
+// Otherwise, e.g. on older servers or after the stream was trimmed, up to 1000 undelivered entries are counted
+// from the stream itself and EntriesBehindCapped is set when there are more
+// it requires the following parameters:
+// streamKey: the stream key of the consumer group
+// consumerGroup: the consumer group to measure
+func (r *RedisStreamsClient) Lag(ctx context.Context, streamKey string, consumerGroup string) (*GroupLag, error) {
+	group, err := r.GroupInfo(ctx, streamKey, consumerGroup)
+	if err != nil {
+		return nil, err
+	}
+	return r.groupLag(ctx, streamKey, group)
+}
+
+func (r *RedisStreamsClient) groupLag(ctx context.Context, streamKey string, group *GroupInfo) (*GroupLag, error) {
+	lag := &GroupLag{
+		StreamName:      streamKey,
+		ConsumerGroup:   group.Name,
+		Pending:         group.Pending,
+		LastDeliveredID: group.LastDeliveredID,
+	}
+	last, err := r.client.XRevRangeN(ctx, streamKey, "+", "-", 1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error reading last entry of stream %s: %v", streamKey, err)
+	}
+	if len(last) == 0 {
+		return lag, nil
+	}
+	lag.LastEntryID = last[0].ID
+	start, err := nextStreamID(group.LastDeliveredID)
+	if err != nil {
+		return nil, err
+	}
+	oldest, err := r.client.XRangeN(ctx, streamKey, start, "+", 1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error reading undelivered entries of stream %s: %v", streamKey, err)
+	}
+	if len(oldest) == 0 {
+		return lag, nil
+	}
+	oldestTime, err := StreamIDTime(oldest[0].ID)
+	if err != nil {
+		return nil, err
+	}
+	lag.TimeBehind = time.Since(oldestTime)
+	if lag.TimeBehind < 0 {
+		lag.TimeBehind = 0
+	}
+	// go-redis reads a lag Redis could not determine, and the fields older servers do not send, as 0
+	if group.EntriesRead > 0 && group.Lag > 0 {
+		lag.EntriesBehind = group.Lag
+		return lag, nil
+	}
+	entries, err := r.client.XRangeN(ctx, streamKey, start, "+", lagScanLimit+1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error reading undelivered entries of stream %s: %v", streamKey, err)
+	}
+	lag.EntriesBehind = int64(len(entries))
+	if lag.EntriesBehind > lagScanLimit {
+		lag.EntriesBehind = lagScanLimit
+		lag.EntriesBehindCapped = true
+	}
+	return lag, nil
+}
+
+// LagWatcherConfig describes which streams a LagWatcher polls and when it alerts.
+// A zero threshold is ignored, so setting only MaxTimeBehind alerts on time behind alone
+type LagWatcherConfig struct {
+	Streams          []string
+	Interval         time.Duration
+	MaxEntriesBehind int64
+	MaxTimeBehind    time.Duration
+	// OnThresholdExceeded is called on every poll for every group that is over one of the thresholds
+	OnThresholdExceeded func(lag GroupLag)
+}
+
+// LagWatcher periodically measures the lag of every consumer group on a set of streams
+type LagWatcher struct {
+	client *RedisStreamsClient
+	config LagWatcherConfig
+}
+
+// WatchLag creates a LagWatcher, call Run to start polling or Check to measure once
+func (r *RedisStreamsClient) WatchLag(config LagWatcherConfig) *LagWatcher {
+	if config.Interval <= 0 {
+		config.Interval = 30 * time.Second
+	}
+	return &LagWatcher{
+		client: r,
+		config: config,
+	}
+}
+
+// Run polls the lag of all groups every interval until the context is cancelled
+func (w *LagWatcher) Run(ctx context.Context) error {
+	runEvery(ctx, w.config.Interval, func(ctx context.Context) {
+		_, err := w.Check(ctx)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Error checking consumer lag: %v\n", err)
+		}
+	})
+	return nil
+}
+
+// Check measures the lag of every group on the watched streams once, calling the threshold callback where needed.
+// Streams that do not exist yet are skipped
+func (w *LagWatcher) Check(ctx context.Context) ([]GroupLag, error) {
+	lags := make([]GroupLag, 0)
+	for _, stream := range w.config.Streams {
+		exists, err := w.client.client.Exists(ctx, stream).Result()
+		if err != nil {
+			return lags, fmt.Errorf("error checking if stream %s exists: %v", stream, err)
+		}
+		if exists == 0 {
+			continue
+		}
+		groups, err := w.client.GroupsInfo(ctx, stream)
+		if err != nil {
+			return lags, err
+		}
+		for i := range groups {
+			lag, err := w.client.groupLag(ctx, stream, &groups[i])
+			if err != nil {
+				return lags, err
+			}
+			lags = append(lags, *lag)
+			if w.exceeded(lag) && w.config.OnThresholdExceeded != nil {
+				w.config.OnThresholdExceeded(*lag)
+			}
+		}
+	}
+	return lags, nil
+}
+
+func (w *LagWatcher) exceeded(lag *GroupLag) bool {
+	if w.config.MaxEntriesBehind > 0 && lag.EntriesBehind > w.config.MaxEntriesBehind {
+		return true
+	}
+	return w.config.MaxTimeBehind > 0 && lag.TimeBehind > w.config.MaxTimeBehind
+}
@@ -0,0 +1,190 @@
+package rediswrapper
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/a-agmon/redis-streams-wrapper/generate"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLagOfGroupCreatedMidStream(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t, "lag-consumer")
+	stream := generate.RandomStringWithPrefix("LAGSTREAM")
+	group := generate.RandomStringWithPrefix("LAGGROUP")
+	produceMessagesTo(t, c, stream, 10)
+	// a group created at the end of the stream has not missed anything
+	err := c.client.XGroupCreate(ctx, stream, group, "$").Err()
+	if err != nil {
+		t.Fatalf("Error creating consumer group: %v", err)
+	}
+	lag, err := c.Lag(ctx, stream, group)
+	if err != nil {
+		t.Fatalf("Error measuring lag: %v", err)
+	}
+	assert.EqualValues(t, 0, lag.EntriesBehind)
+	assert.EqualValues(t, 0, lag.TimeBehind)
+
+	produceMessagesTo(t, c, stream, 4)
+	lag, err = c.Lag(ctx, stream, group)
+	if err != nil {
+		t.Fatalf("Error measuring lag: %v", err)
+	}
+	assert.EqualValues(t, 4, lag.EntriesBehind)
+
+	_, err = c.FetchNewMessages(ctx, stream, group, 3, 1)
+	if err != nil {
+		t.Fatalf("Error polling for new messages: %v", err)
+	}
+	lag, err = c.Lag(ctx, stream, group)
+	if err != nil {
+		t.Fatalf("Error measuring lag: %v", err)
+	}
+	assert.EqualValues(t, 1, lag.EntriesBehind)
+	assert.EqualValues(t, 3, lag.Pending)
+}
+
+func TestLagAfterTrim(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t, "lag-consumer")
+	stream := generate.RandomStringWithPrefix("LAGSTREAM")
+	group := generate.RandomStringWithPrefix("LAGGROUP")
+	produceMessagesTo(t, c, stream, 10)
+	_, err := c.FetchNewMessages(ctx, stream, group, 2, 1)
+	if err != nil {
+		t.Fatalf("Error polling for new messages: %v", err)
+	}
+	// trimming drops 5 undelivered entries, only 3 are left for the group
+	err = c.client.XTrimMaxLen(ctx, stream, 3).Err()
+	if err != nil {
+		t.Fatalf("Error trimming stream: %v", err)
+	}
+	lag, err := c.Lag(ctx, stream, group)
+	if err != nil {
+		t.Fatalf("Error measuring lag: %v", err)
+	}
+	assert.EqualValues(t, 3, lag.EntriesBehind)
+}
+
+func TestLagTimeBehind(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t, "lag-consumer")
+	stream := generate.RandomStringWithPrefix("LAGSTREAM")
+	group := generate.RandomStringWithPrefix("LAGGROUP")
+	anHourAgo := time.Now().Add(-time.Hour)
+	err := c.client.XAdd(ctx, &redis.XAddArgs{Stream: stream, ID: StreamIDFromTime(anHourAgo), Values: map[string]interface{}{"test": "test"}}).Err()
+	if err != nil {
+		t.Fatalf("Error producing message: %v", err)
+	}
+	produceMessagesTo(t, c, stream, 1)
+	err = c.createConsumerGroupIfNotExists(ctx, stream, group)
+	if err != nil {
+		t.Fatalf("Error creating consumer group: %v", err)
+	}
+	lag, err := c.Lag(ctx, stream, group)
+	if err != nil {
+		t.Fatalf("Error measuring lag: %v", err)
+	}
+	assert.EqualValues(t, 2, lag.EntriesBehind)
+	assert.InDelta(t, time.Hour.Seconds(), lag.TimeBehind.Seconds(), 5)
+}
+
+func TestLagWatcherThresholds(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t, "lag-consumer")
+	stream := generate.RandomStringWithPrefix("LAGSTREAM")
+	slowGroup := generate.RandomStringWithPrefix("LAGGROUP")
+	fastGroup := generate.RandomStringWithPrefix("LAGGROUP")
+	produceMessagesTo(t, c, stream, 5)
+	err := c.createConsumerGroupIfNotExists(ctx, stream, slowGroup)
+	if err != nil {
+		t.Fatalf("Error creating consumer group: %v", err)
+	}
+	_, err = c.FetchNewMessages(ctx, stream, fastGroup, 5, 1)
+	if err != nil {
+		t.Fatalf("Error polling for new messages: %v", err)
+	}
+	alerted := make([]string, 0)
+	watcher := c.WatchLag(LagWatcherConfig{
+		Streams:          []string{stream, generate.RandomStringWithPrefix("MISSINGSTREAM")},
+		MaxEntriesBehind: 2,
+		OnThresholdExceeded: func(lag GroupLag) {
+			alerted = append(alerted, lag.ConsumerGroup)
+		},
+	})
+	lags, err := watcher.Check(ctx)
+	if err != nil {
+		t.Fatalf("Error checking lag: %v", err)
+	}
+	assert.EqualValues(t, 2, len(lags))
+	assert.EqualValues(t, []string{slowGroup}, alerted)
+}
+
+// commandHook records the arguments of every command sent with the given name
+type commandHook struct {
+	name string
+	args [][]interface{}
+}
+
+func (h *commandHook) DialHook(next redis.DialHook) redis.DialHook {
+	return next
+}
+
+func (h *commandHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		if cmd.Name() == h.name {
+			h.args = append(h.args, cmd.Args())
+		}
+		return next(ctx, cmd)
+	}
+}
+
+func (h *commandHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return next
+}
+
+func TestLagUsesLagReportedByRedis(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t, "lag-consumer")
+	hook := &commandHook{name: "xrange"}
+	c.client.AddHook(hook)
+	stream := generate.RandomStringWithPrefix("LAGSTREAM")
+	addEntriesWithIDs(t, c, stream, "1000-0", "2000-0", "3000-0")
+	// a group Redis 7 knows to be 5000 entries behind, most of them trimmed since
+	lag, err := c.groupLag(ctx, stream, &GroupInfo{Name: "reported", LastDeliveredID: "1000-0", EntriesRead: 10, Lag: 5000})
+	if err != nil {
+		t.Fatalf("Error measuring lag: %v", err)
+	}
+	assert.EqualValues(t, 5000, lag.EntriesBehind)
+	assert.False(t, lag.EntriesBehindCapped)
+	assert.InDelta(t, time.Since(time.UnixMilli(2000)).Seconds(), lag.TimeBehind.Seconds(), 5)
+	// the time behind is read from the oldest undelivered entry alone
+	assert.EqualValues(t, [][]interface{}{{"xrange", stream, "1000-1", "+", "count", int64(1)}}, hook.args)
+}
+
+func TestLagCountIsCapped(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t, "lag-consumer")
+	stream := generate.RandomStringWithPrefix("LAGSTREAM")
+	group := generate.RandomStringWithPrefix("LAGGROUP")
+	pipe := c.client.Pipeline()
+	for i := 0; i < lagScanLimit+5; i++ {
+		pipe.XAdd(ctx, &redis.XAddArgs{Stream: stream, Values: map[string]interface{}{"messageindex": i}})
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		t.Fatalf("Error producing messages: %v", err)
+	}
+	err := c.client.XGroupCreate(ctx, stream, group, "0").Err()
+	if err != nil {
+		t.Fatalf("Error creating consumer group: %v", err)
+	}
+	lag, err := c.Lag(ctx, stream, group)
+	if err != nil {
+		t.Fatalf("Error measuring lag: %v", err)
+	}
+	assert.EqualValues(t, lagScanLimit, lag.EntriesBehind)
+	assert.True(t, lag.EntriesBehindCapped)
+}
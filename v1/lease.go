@@ -0,0 +1,94 @@
+package rediswrapper
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// LeaseConfig controls the lease extension of messages while the handler of a Subscription runs.
+// Extension is disabled when Interval is zero
+type LeaseConfig struct {
+	// Interval is how often the idle time of a message being handled is reset, it must be well below
+	// the ReclaimConfig.MinIdle of every consumer reclaiming the group
+	Interval time.Duration
+}
+
+// extendLeaseScript resets the idle time of a message, provided it is still pending for this consumer.
+// KEYS holds the stream, ARGV the group, message ID and consumer. It returns 0 if the message is no longer owned
+var extendLeaseScript = redis.NewScript(`
+local pending = redis.call('XPENDING', KEYS[1], ARGV[1], ARGV[2], ARGV[2], 1)
+if #pending == 0 or pending[1][2] ~= ARGV[3] then
+	return 0
+end
+redis.call('XCLAIM', KEYS[1], ARGV[1], ARGV[3], 0, ARGV[2], 'JUSTID')
+return 1
+`)
+
+// ExtendLease resets the idle time of a message this consumer is processing, so consumers reclaiming abandoned
+// messages don't take it. It returns false if the message is no longer pending for this consumer, because it was
+// acked or claimed by another consumer
+// it requires the following parameters:
+// msg: the consumed message, as returned by FetchNewMessages or ClaimMessagesNotAcked
+func (r *RedisStreamsClient) ExtendLease(ctx context.Context, msg RedisStreamsMessage) (bool, error) {
+	start := time.Now()
+	owned, err := extendLeaseScript.Run(ctx, r.client, []string{msg.StreamName}, msg.ConsumerGroup, msg.ID, r.messageConsumer(msg)).Int()
+	r.observeOperation(OperationClaim, msg.StreamName, msg.ConsumerGroup, 1, start, err)
+	if err != nil {
+		return false, fmt.Errorf("error extending lease of message %s: %v", msg.ID, err)
+	}
+	return owned == 1, nil
+}
+
+// lease keeps a message owned while its handler runs, and cancels the handler's context if ownership is lost
+type lease struct {
+	lost bool
+	stop chan struct{}
+	done sync.WaitGroup
+}
+
+// startLease extends the lease of the message every Lease.Interval until stop is called.
+// It returns the context to run the handler with, which is cancelled once the message is owned by another consumer
+func (s *Subscription) startLease(ctx context.Context, message RedisStreamsMessage) (context.Context, *lease) {
+	handlerCtx, cancel := context.WithCancel(ctx)
+	l := &lease{stop: make(chan struct{})}
+	l.done.Add(1)
+	go func() {
+		defer l.done.Done()
+		defer cancel()
+		ticker := time.NewTicker(s.config.Lease.Interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-l.stop:
+				return
+			case <-handlerCtx.Done():
+				return
+			case <-ticker.C:
+			}
+			owned, err := s.client.ExtendLease(handlerCtx, message)
+			if err != nil {
+				// the next tick retries, the lease is only lost once another consumer owns the message
+				log.Printf("Error extending lease of message %s on stream %s: %v\n", message.ID, message.StreamName, err)
+				continue
+			}
+			if !owned {
+				log.Printf("Lost lease of message %s on stream %s, cancelling its handler\n", message.ID, message.StreamName)
+				l.lost = true
+				return
+			}
+		}
+	}()
+	return handlerCtx, l
+}
+
+// finish stops extending the lease and reports whether it was lost while the handler ran
+func (l *lease) finish() bool {
+	close(l.stop)
+	l.done.Wait()
+	return l.lost
+}
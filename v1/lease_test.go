@@ -0,0 +1,118 @@
+package rediswrapper
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/a-agmon/redis-streams-wrapper/generate"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExtendLease(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t, "lease-owner")
+	stream := generate.RandomStringWithPrefix("LEASESTREAM")
+	group := generate.RandomStringWithPrefix("LEASEGROUP")
+	messages := fetchPending(t, c, stream, group, 1)
+	owned, err := c.ExtendLease(ctx, messages[0])
+	if err != nil {
+		t.Fatalf("Error extending lease: %v", err)
+	}
+	assert.True(t, owned)
+
+	other := newTestClient(t, "lease-thief")
+	_, err = other.ClaimMessagesByID(ctx, stream, group, []string{messages[0].ID})
+	if err != nil {
+		t.Fatalf("Error claiming messages: %v", err)
+	}
+	owned, err = c.ExtendLease(ctx, messages[0])
+	if err != nil {
+		t.Fatalf("Error extending lease: %v", err)
+	}
+	assert.False(t, owned)
+	pending, err := c.PendingMessages(ctx, stream, group, 10)
+	if err != nil {
+		t.Fatalf("Error listing pending messages: %v", err)
+	}
+	assert.EqualValues(t, "lease-thief", pending[0].Consumer)
+}
+
+func TestSubscriptionExtendsLease(t *testing.T) {
+	c := newTestClient(t, "lease-subscriber")
+	stream := generate.RandomStringWithPrefix("LEASESTREAM")
+	group := generate.RandomStringWithPrefix("LEASEGROUP")
+	produceMessagesTo(t, c, stream, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var idleDuringHandler []PendingEntryInfo
+	sub := c.Subscribe(SubscriptionConfig{
+		StreamName:     stream,
+		ConsumerGroup:  group,
+		WaitForSeconds: 1,
+		Lease:          LeaseConfig{Interval: 20 * time.Millisecond},
+	}, func(ctx context.Context, msg RedisStreamsMessage) error {
+		defer cancel()
+		// the handler outlives the idle threshold several times over
+		time.Sleep(300 * time.Millisecond)
+		var err error
+		idleDuringHandler, err = c.ListPending(context.Background(), stream, group, PendingFilter{MinIdle: 100 * time.Millisecond})
+		return err
+	})
+	err := sub.Run(ctx)
+	if err != nil {
+		t.Fatalf("Error running subscription: %v", err)
+	}
+	assert.EqualValues(t, 0, len(idleDuringHandler))
+	assert.EqualValues(t, 1, sub.Stats().Processed)
+	assert.EqualValues(t, 0, sub.Stats().LeasesLost)
+	pending, err := c.PendingMessages(context.Background(), stream, group, 10)
+	if err != nil {
+		t.Fatalf("Error listing pending messages: %v", err)
+	}
+	assert.EqualValues(t, 0, len(pending))
+}
+
+func TestSubscriptionCancelsHandlerWhenLeaseIsLost(t *testing.T) {
+	c := newTestClient(t, "lease-subscriber")
+	other := newTestClient(t, "lease-thief")
+	stream := generate.RandomStringWithPrefix("LEASESTREAM")
+	group := generate.RandomStringWithPrefix("LEASEGROUP")
+	produceMessagesTo(t, c, stream, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var handlerErr error
+	sub := c.Subscribe(SubscriptionConfig{
+		StreamName:     stream,
+		ConsumerGroup:  group,
+		WaitForSeconds: 1,
+		Lease:          LeaseConfig{Interval: 20 * time.Millisecond},
+	}, func(handlerCtx context.Context, msg RedisStreamsMessage) error {
+		defer cancel()
+		_, err := other.ClaimMessagesByID(context.Background(), stream, group, []string{msg.ID})
+		if err != nil {
+			return err
+		}
+		select {
+		case <-handlerCtx.Done():
+			handlerErr = handlerCtx.Err()
+		case <-time.After(time.Second):
+		}
+		return nil
+	})
+	err := sub.Run(ctx)
+	if err != nil {
+		t.Fatalf("Error running subscription: %v", err)
+	}
+	assert.ErrorIs(t, handlerErr, context.Canceled)
+	assert.EqualValues(t, 0, sub.Stats().Processed)
+	assert.EqualValues(t, 1, sub.Stats().Failed)
+	assert.EqualValues(t, 1, sub.Stats().LeasesLost)
+	// the message was not acked, it is left to its new owner
+	pending, err := c.PendingMessages(context.Background(), stream, group, 10)
+	if err != nil {
+		t.Fatalf("Error listing pending messages: %v", err)
+	}
+	assert.EqualValues(t, 1, len(pending))
+	assert.EqualValues(t, "lease-thief", pending[0].Consumer)
+}
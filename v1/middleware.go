@@ -0,0 +1,77 @@
+package rediswrapper
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"runtime/debug"
+	"time"
+)
+
+// Middleware wraps a MessageHandler to add behaviour around every message, such as logging or panic recovery
+type Middleware func(next MessageHandler) MessageHandler
+
+// Use adds middlewares to the subscription's handler. Middlewares run in the order they were added,
+// the first one being the outermost. Use must be called before Run
+func (s *Subscription) Use(middlewares ...Middleware) *Subscription {
+	s.middlewares = append(s.middlewares, middlewares...)
+	return s
+}
+
+// chain wraps handler with the given middlewares, the first middleware being the outermost
+func chain(handler MessageHandler, middlewares []Middleware) MessageHandler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
+
+// RecoverMiddleware converts a panic in the handler into an error instead of crashing the process.
+// The message is released with NackRelease, so the next reclaim scan hands it to a consumer again
+func RecoverMiddleware() Middleware {
+	return func(next MessageHandler) MessageHandler {
+		return func(ctx context.Context, msg RedisStreamsMessage) (err error) {
+			defer func() {
+				if recovered := recover(); recovered != nil {
+					log.Printf("Recovered from panic handling message %s on stream %s: %v\n%s", msg.ID, msg.StreamName, recovered, debug.Stack())
+					err = NackWith(fmt.Errorf("panic handling message %s: %v", msg.ID, recovered), NackOptions{Mode: NackRelease})
+				}
+			}()
+			return next(ctx, msg)
+		}
+	}
+}
+
+// TimeoutMiddleware gives every message a context that expires after timeout.
+// The handler is expected to honour the context, it is not interrupted
+func TimeoutMiddleware(timeout time.Duration) Middleware {
+	return func(next MessageHandler) MessageHandler {
+		return func(ctx context.Context, msg RedisStreamsMessage) error {
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+			return next(ctx, msg)
+		}
+	}
+}
+
+// LoggingMiddleware logs one logfmt line per handled message with its stream, group, id, duration and error.
+// The standard logger is used when logger is nil
+func LoggingMiddleware(logger *log.Logger) Middleware {
+	if logger == nil {
+		logger = log.Default()
+	}
+	return func(next MessageHandler) MessageHandler {
+		return func(ctx context.Context, msg RedisStreamsMessage) error {
+			start := time.Now()
+			err := next(ctx, msg)
+			if err != nil {
+				logger.Printf("level=error msg=%q stream=%q group=%q consumer=%q id=%s duration=%s error=%q",
+					"message handling failed", msg.StreamName, msg.ConsumerGroup, msg.ConsumerName, msg.ID, time.Since(start), err.Error())
+				return err
+			}
+			logger.Printf("level=info msg=%q stream=%q group=%q consumer=%q id=%s duration=%s",
+				"message handled", msg.StreamName, msg.ConsumerGroup, msg.ConsumerName, msg.ID, time.Since(start))
+			return nil
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package rediswrapper
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/a-agmon/redis-streams-wrapper/generate"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMiddlewareOrder(t *testing.T) {
+	calls := make([]string, 0)
+	record := func(name string) Middleware {
+		return func(next MessageHandler) MessageHandler {
+			return func(ctx context.Context, msg RedisStreamsMessage) error {
+				calls = append(calls, name+" before")
+				err := next(ctx, msg)
+				calls = append(calls, name+" after")
+				return err
+			}
+		}
+	}
+	handler := chain(func(ctx context.Context, msg RedisStreamsMessage) error {
+		calls = append(calls, "handler")
+		return nil
+	}, []Middleware{record("first"), record("second")})
+	err := handler(context.Background(), RedisStreamsMessage{})
+	assert.NoError(t, err)
+	assert.EqualValues(t, []string{"first before", "second before", "handler", "second after", "first after"}, calls)
+}
+
+func TestRecoverMiddlewareReleasesMessage(t *testing.T) {
+	c := newTestClient(t, "panicking-consumer")
+	stream := generate.RandomStringWithPrefix("MWSTREAM")
+	group := generate.RandomStringWithPrefix("MWGROUP")
+	produceMessagesTo(t, c, stream, 2)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	handled := 0
+	sub := c.Subscribe(SubscriptionConfig{StreamName: stream, ConsumerGroup: group, WaitForSeconds: 1},
+		func(ctx context.Context, msg RedisStreamsMessage) error {
+			handled++
+			if handled == 2 {
+				cancel()
+			}
+			if msg.Properties["messageindex"] == "0" {
+				panic("cannot handle the first message")
+			}
+			return nil
+		}).Use(RecoverMiddleware())
+	err := sub.Run(ctx)
+	if err != nil {
+		t.Fatalf("Error running subscription: %v", err)
+	}
+	stats := sub.Stats()
+	assert.EqualValues(t, 1, stats.Failed)
+	assert.EqualValues(t, 1, stats.Processed)
+	pending, err := c.client.XPending(context.Background(), stream, group).Result()
+	if err != nil {
+		t.Fatalf("Error fetching pending summary: %v", err)
+	}
+	assert.EqualValues(t, 1, pending.Count)
+	// the message that panicked was released, so it is idle enough for any reclaim scan to claim it
+	released, err := c.ListPending(context.Background(), stream, group, PendingFilter{MinIdle: time.Hour})
+	if err != nil {
+		t.Fatalf("Error listing pending messages: %v", err)
+	}
+	assert.EqualValues(t, 1, len(released))
+}
+
+func TestTimeoutMiddleware(t *testing.T) {
+	handler := TimeoutMiddleware(10 * time.Millisecond)(func(ctx context.Context, msg RedisStreamsMessage) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	err := handler(context.Background(), RedisStreamsMessage{})
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+}
+
+func TestLoggingMiddleware(t *testing.T) {
+	var buf bytes.Buffer
+	logger := log.New(&buf, "", 0)
+	handler := LoggingMiddleware(logger)(func(ctx context.Context, msg RedisStreamsMessage) error {
+		if msg.ID == "2-0" {
+			return errors.New("boom")
+		}
+		return nil
+	})
+	_ = handler(context.Background(), RedisStreamsMessage{ID: "1-0", StreamName: "orders", ConsumerGroup: "billing"})
+	_ = handler(context.Background(), RedisStreamsMessage{ID: "2-0", StreamName: "orders", ConsumerGroup: "billing"})
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.EqualValues(t, 2, len(lines))
+	assert.Contains(t, lines[0], `level=info msg="message handled" stream="orders" group="billing"`)
+	assert.Contains(t, lines[0], "id=1-0")
+	assert.Contains(t, lines[1], `level=error`)
+	assert.Contains(t, lines[1], `error="boom"`)
+}
@@ -0,0 +1,164 @@
+package rediswrapper
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// NackAttemptField is the field counting how many times a message was requeued by Nack
+const NackAttemptField = "nack_attempt"
+
+// releasedIdle is the idle time given to a released message when the min idle of the reclaiming consumers is unknown,
+// long enough for any reasonable ReclaimConfig.MinIdle
+const releasedIdle = 7 * 24 * time.Hour
+
+// NackMode selects how Nack hands a message back
+type NackMode int
+
+const (
+	// NackRelease leaves the message pending and marks it idle, so the next reclaim scan of any consumer claims it
+	NackRelease NackMode = iota
+	// NackRequeue adds a copy of the message at the end of the stream with NackAttemptField incremented,
+	// and acks the original in the same script
+	NackRequeue
+)
+
+// NackOptions controls how a message is negatively acknowledged
+type NackOptions struct {
+	Mode NackMode
+	// Delay postpones the redelivery. A released message becomes claimable once Delay has passed, which requires
+	// ReclaimMinIdle. A requeued message stays pending for Delay before it is requeued, if the process stops
+	// in the meantime it is recovered like any abandoned message. Keep it below the min idle of the reclaiming consumers
+	Delay time.Duration
+	// ReclaimMinIdle is the ReclaimConfig.MinIdle of the consumers reclaiming the group, used by NackRelease.
+	// When zero the message is made to look idle for a week
+	ReclaimMinIdle time.Duration
+}
+
+// nackReleaseScript sets the idle time of a pending message, provided it is still pending for this consumer.
+// KEYS holds the stream, ARGV the group, message ID, consumer and idle time in milliseconds
+var nackReleaseScript = redis.NewScript(`
+local pending = redis.call('XPENDING', KEYS[1], ARGV[1], ARGV[2], ARGV[2], 1)
+if #pending == 0 or pending[1][2] ~= ARGV[3] then
+	return redis.error_reply('NOTPENDING message ' .. ARGV[2] .. ' is not pending for consumer ' .. ARGV[3])
+end
+redis.call('XCLAIM', KEYS[1], ARGV[1], ARGV[3], 0, ARGV[2], 'IDLE', ARGV[4], 'JUSTID')
+return 1
+`)
+
+// Nack negatively acknowledges a message this consumer failed to process, so it is delivered again without
+// waiting for it to become abandoned. It returns the ID of the requeued entry, which is empty when the message
+// was released or its requeue was delayed. Nack fails if the message is no longer pending for this consumer
+// it requires the following parameters:
+// msg: the consumed message, as returned by FetchNewMessages or ClaimMessagesNotAcked
+// options: whether to release or requeue the message, and after how long
+func (r *RedisStreamsClient) Nack(ctx context.Context, msg RedisStreamsMessage, options NackOptions) (string, error) {
+	if options.Delay < 0 {
+		return "", fmt.Errorf("nack delay cannot be negative")
+	}
+	switch options.Mode {
+	case NackRelease:
+		return "", r.nackRelease(ctx, msg, options)
+	case NackRequeue:
+		if options.Delay == 0 {
+			return r.nackRequeue(ctx, msg)
+		}
+		err := r.lifecycle.afterFunc(options.Delay, func() {
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if _, err := r.nackRequeue(ctx, msg); err != nil {
+				log.Printf("Error requeuing message %s on stream %s: %v\n", msg.ID, msg.StreamName, err)
+			}
+		})
+		if err != nil {
+			return "", fmt.Errorf("error requeuing message %s: %v", msg.ID, err)
+		}
+		return "", nil
+	default:
+		return "", fmt.Errorf("unknown nack mode %d", options.Mode)
+	}
+}
+
+// nackRelease makes the message look idle for long enough that reclaiming consumers claim it after options.Delay
+func (r *RedisStreamsClient) nackRelease(ctx context.Context, msg RedisStreamsMessage, options NackOptions) error {
+	idle := releasedIdle
+	if options.ReclaimMinIdle > 0 {
+		idle = options.ReclaimMinIdle - options.Delay
+	} else if options.Delay > 0 {
+		return fmt.Errorf("releasing message %s with a delay requires the reclaim min idle", msg.ID)
+	}
+	if idle < 0 {
+		idle = 0
+	}
+	start := time.Now()
+	err := nackReleaseScript.Run(ctx, r.client, []string{msg.StreamName},
+		msg.ConsumerGroup, msg.ID, r.messageConsumer(msg), idle.Milliseconds()).Err()
+	r.observeOperation(OperationClaim, msg.StreamName, msg.ConsumerGroup, 1, start, err)
+	if err != nil {
+		return fmt.Errorf("error releasing message %s: %v", msg.ID, err)
+	}
+	log.Printf("Consumer %s released message %s on group %s\n", r.messageConsumer(msg), msg.ID, msg.ConsumerGroup)
+	return nil
+}
+
+// nackRequeue adds a copy of the message with its attempt incremented and acks the original
+func (r *RedisStreamsClient) nackRequeue(ctx context.Context, msg RedisStreamsMessage) (string, error) {
+	payload := copyPayload(msg.Properties)
+	payload[NackAttemptField] = NackAttempt(msg) + 1
+	ids, err := r.ProduceAndAck(ctx, msg, []RedisStreamsMessage{{StreamName: msg.StreamName, Properties: payload}})
+	if err != nil {
+		return "", fmt.Errorf("error requeuing message %s: %v", msg.ID, err)
+	}
+	log.Printf("Requeued message %s on stream %s as message %s\n", msg.ID, msg.StreamName, ids[0])
+	return ids[0], nil
+}
+
+// messageConsumer returns the consumer a message was delivered to, this client's consumer by default
+func (r *RedisStreamsClient) messageConsumer(msg RedisStreamsMessage) string {
+	if msg.ConsumerName != "" {
+		return msg.ConsumerName
+	}
+	return r.Config.ConsumerName
+}
+
+// NackAttempt returns how many times a message was requeued by Nack, 0 for a message that never was
+func NackAttempt(msg RedisStreamsMessage) int {
+	attempt, err := strconv.Atoi(payloadString(msg.Properties, NackAttemptField))
+	if err != nil {
+		return 0
+	}
+	return attempt
+}
+
+// NackError is returned by a subscription handler to have the message negatively acknowledged instead of left pending
+type NackError struct {
+	Err     error
+	Options NackOptions
+}
+
+func (e *NackError) Error() string {
+	return fmt.Sprintf("nack: %v", e.Err)
+}
+
+func (e *NackError) Unwrap() error {
+	return e.Err
+}
+
+// NackWith wraps a handler error so the Subscription nacks the message with the given options.
+// NackOptions.ReclaimMinIdle defaults to the ReclaimConfig.MinIdle of the subscription
+func NackWith(err error, options NackOptions) error {
+	return &NackError{Err: err, Options: options}
+}
+
+// asNackError returns the NackError in the chain of err, if any
+func asNackError(err error) (*NackError, bool) {
+	var nackErr *NackError
+	ok := errors.As(err, &nackErr)
+	return nackErr, ok
+}
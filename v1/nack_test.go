@@ -0,0 +1,161 @@
+package rediswrapper
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/a-agmon/redis-streams-wrapper/generate"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNackRequeue(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t, "nack-consumer")
+	stream := generate.RandomStringWithPrefix("NACKSTREAM")
+	group := generate.RandomStringWithPrefix("NACKGROUP")
+	messages := fetchPending(t, c, stream, group, 1)
+	assert.EqualValues(t, 0, NackAttempt(messages[0]))
+
+	for attempt := 1; attempt <= 2; attempt++ {
+		id, err := c.Nack(ctx, messages[0], NackOptions{Mode: NackRequeue})
+		if err != nil {
+			t.Fatalf("Error nacking message: %v", err)
+		}
+		pending, err := c.PendingMessages(ctx, stream, group, 10)
+		if err != nil {
+			t.Fatalf("Error listing pending messages: %v", err)
+		}
+		assert.EqualValues(t, 0, len(pending))
+		messages, err = c.FetchNewMessages(ctx, stream, group, 10, 1)
+		if err != nil {
+			t.Fatalf("Error polling for new messages: %v", err)
+		}
+		assert.EqualValues(t, 1, len(messages))
+		assert.EqualValues(t, id, messages[0].ID)
+		assert.EqualValues(t, attempt, NackAttempt(messages[0]))
+		assert.EqualValues(t, "0", messages[0].Properties["messageindex"])
+	}
+
+	// a message that is no longer pending for this consumer is not requeued
+	other := newTestClient(t, "nack-other")
+	_, err := other.ClaimMessagesByID(ctx, stream, group, []string{messages[0].ID})
+	if err != nil {
+		t.Fatalf("Error claiming messages: %v", err)
+	}
+	_, err = c.Nack(ctx, messages[0], NackOptions{Mode: NackRequeue})
+	assert.Error(t, err)
+	length, err := c.client.XLen(ctx, stream).Result()
+	if err != nil {
+		t.Fatalf("Error reading stream length: %v", err)
+	}
+	assert.EqualValues(t, 3, length)
+}
+
+func TestNackRequeueWithDelay(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t, "nack-consumer")
+	stream := generate.RandomStringWithPrefix("NACKSTREAM")
+	group := generate.RandomStringWithPrefix("NACKGROUP")
+	messages := fetchPending(t, c, stream, group, 1)
+	id, err := c.Nack(ctx, messages[0], NackOptions{Mode: NackRequeue, Delay: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Error nacking message: %v", err)
+	}
+	assert.Empty(t, id)
+	// the message stays pending until the delay passed
+	pending, err := c.PendingMessages(ctx, stream, group, 10)
+	if err != nil {
+		t.Fatalf("Error listing pending messages: %v", err)
+	}
+	assert.EqualValues(t, 1, len(pending))
+	assert.Eventually(t, func() bool {
+		pending, err := c.PendingMessages(ctx, stream, group, 10)
+		return err == nil && len(pending) == 0
+	}, time.Second, 10*time.Millisecond)
+	messages, err = c.FetchNewMessages(ctx, stream, group, 10, 1)
+	if err != nil {
+		t.Fatalf("Error polling for new messages: %v", err)
+	}
+	assert.EqualValues(t, 1, len(messages))
+	assert.EqualValues(t, 1, NackAttempt(messages[0]))
+}
+
+func TestNackRelease(t *testing.T) {
+	ctx := context.Background()
+	stream := generate.RandomStringWithPrefix("NACKSTREAM")
+	group := generate.RandomStringWithPrefix("NACKGROUP")
+	// a server of its own, since idle times are controlled by setting its clock
+	s := miniredis.RunT(t)
+	c := NewRedisClientWrapper(RedisClientConfig{Addr: s.Addr(), ConsumerName: "nack-consumer"})
+	defer c.CloseConnection()
+	now := time.Now()
+	s.SetTime(now)
+	messages := fetchPending(t, c, stream, group, 2)
+	idleIDs := func(minIdle time.Duration) []string {
+		entries, err := c.ListPending(ctx, stream, group, PendingFilter{MinIdle: minIdle})
+		if err != nil {
+			t.Fatalf("Error listing pending messages: %v", err)
+		}
+		ids := make([]string, 0, len(entries))
+		for _, entry := range entries {
+			ids = append(ids, entry.ID)
+		}
+		return ids
+	}
+	assert.Empty(t, idleIDs(time.Minute))
+
+	_, err := c.Nack(ctx, messages[0], NackOptions{Mode: NackRelease, ReclaimMinIdle: time.Minute})
+	if err != nil {
+		t.Fatalf("Error nacking message: %v", err)
+	}
+	_, err = c.Nack(ctx, messages[1], NackOptions{Mode: NackRelease, ReclaimMinIdle: time.Minute, Delay: 30 * time.Second})
+	if err != nil {
+		t.Fatalf("Error nacking message: %v", err)
+	}
+	assert.EqualValues(t, []string{messages[0].ID}, idleIDs(time.Minute))
+	s.SetTime(now.Add(30 * time.Second))
+	assert.EqualValues(t, []string{messages[0].ID, messages[1].ID}, idleIDs(time.Minute))
+
+	_, err = c.Nack(ctx, messages[0], NackOptions{Mode: NackRelease, Delay: time.Second})
+	assert.Error(t, err)
+	_, err = c.Nack(ctx, RedisStreamsMessage{ID: "1-0", StreamName: stream, ConsumerGroup: group}, NackOptions{Mode: NackRelease})
+	assert.Error(t, err)
+}
+
+func TestSubscriptionNacksWithRequeue(t *testing.T) {
+	c := newTestClient(t, "nack-subscriber")
+	stream := generate.RandomStringWithPrefix("NACKSTREAM")
+	group := generate.RandomStringWithPrefix("NACKGROUP")
+	produceMessagesTo(t, c, stream, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var mu sync.Mutex
+	attempts := make([]int, 0)
+	sub := c.Subscribe(SubscriptionConfig{StreamName: stream, ConsumerGroup: group, WaitForSeconds: 1},
+		func(ctx context.Context, msg RedisStreamsMessage) error {
+			mu.Lock()
+			defer mu.Unlock()
+			attempts = append(attempts, NackAttempt(msg))
+			if NackAttempt(msg) < 2 {
+				return NackWith(errors.New("not yet"), NackOptions{Mode: NackRequeue})
+			}
+			cancel()
+			return nil
+		})
+	err := sub.Run(ctx)
+	if err != nil {
+		t.Fatalf("Error running subscription: %v", err)
+	}
+	assert.EqualValues(t, []int{0, 1, 2}, attempts)
+	assert.EqualValues(t, 1, sub.Stats().Processed)
+	assert.EqualValues(t, 2, sub.Stats().Failed)
+	pending, err := c.PendingMessages(context.Background(), stream, group, 10)
+	if err != nil {
+		t.Fatalf("Error listing pending messages: %v", err)
+	}
+	assert.EqualValues(t, 0, len(pending))
+}
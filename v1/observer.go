@@ -0,0 +1,49 @@
+package rediswrapper
+
+import (
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Operation names reported to an Observer
+const (
+	OperationProduce = "produce"
+	OperationFetch   = "fetch"
+	OperationAck     = "ack"
+	OperationClaim   = "claim"
+)
+
+// Observer receives instrumentation events from a RedisStreamsClient, see the metrics package for a Prometheus implementation.
+// Implementations must be safe for concurrent use and should return quickly
+type Observer interface {
+	// ObserveOperation is called after every produce, fetch, ack and claim call.
+	// group is empty for produce, count is the number of messages produced, fetched, acked or claimed
+	ObserveOperation(operation string, stream string, group string, count int, duration time.Duration, err error)
+	// ObserveHandler is called after a Subscription ran its handler for a message
+	ObserveHandler(stream string, group string, duration time.Duration, err error)
+}
+
+func (r *RedisStreamsClient) observeOperation(operation string, stream string, group string, count int, start time.Time, err error) {
+	if r.Config.Observer != nil {
+		r.Config.Observer.ObserveOperation(operation, stream, group, count, time.Since(start), err)
+	}
+}
+
+// observeFetch reports a XREADGROUP call, redis.Nil means the block time passed without new messages
+func (r *RedisStreamsClient) observeFetch(stream string, group string, streams []redis.XStream, start time.Time, err error) {
+	if err == redis.Nil {
+		err = nil
+	}
+	count := 0
+	for _, xStream := range streams {
+		count += len(xStream.Messages)
+	}
+	r.observeOperation(OperationFetch, stream, group, count, start, err)
+}
+
+func (r *RedisStreamsClient) observeHandler(stream string, group string, start time.Time, err error) {
+	if r.Config.Observer != nil {
+		r.Config.Observer.ObserveHandler(stream, group, time.Since(start), err)
+	}
+}
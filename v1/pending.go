@@ -0,0 +1,204 @@
+package rediswrapper
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// pendingPageSize is the number of pending entries read per XPENDING call
+const pendingPageSize = 1000
+
+// PendingFilter selects pending entries, zero values select every entry
+type PendingFilter struct {
+	// StreamRange selects entries by ID and by the time they were added to the stream
+	StreamRange
+	// Consumer only selects entries owned by this consumer
+	Consumer string
+	// MinIdle only selects entries delivered at least this long ago
+	MinIdle time.Duration
+	// Count is the maximum number of entries returned, 0 for no limit
+	Count int64
+}
+
+// PendingMessages lists the entries of a consumer group that were delivered but not acked yet, oldest first
+// it requires the following parameters:
+// streamKey: the stream key of the consumer group
+// consumerGroup: the consumer group to inspect
+// count: the maximum number of entries returned
+func (r *RedisStreamsClient) PendingMessages(ctx context.Context, streamKey string, consumerGroup string, count int64) ([]PendingEntryInfo, error) {
+	return r.ListPending(ctx, streamKey, consumerGroup, PendingFilter{Count: count})
+}
+
+// ListPending lists the pending entries of a consumer group matching a filter, oldest first.
+// It pages through the whole pending entries list if needed
+// it requires the following parameters:
+// streamKey: the stream key of the consumer group
+// consumerGroup: the consumer group to inspect
+// filter: which entries to return
+func (r *RedisStreamsClient) ListPending(ctx context.Context, streamKey string, consumerGroup string, filter PendingFilter) ([]PendingEntryInfo, error) {
+	start, end, err := filter.bounds()
+	if err != nil {
+		return nil, fmt.Errorf("invalid pending range: %v", err)
+	}
+	entries := make([]PendingEntryInfo, 0)
+	for {
+		pending, err := r.client.XPendingExt(ctx, &redis.XPendingExtArgs{
+			Stream:   streamKey,
+			Group:    consumerGroup,
+			Start:    start,
+			End:      end,
+			Count:    pendingPageSize,
+			Consumer: filter.Consumer,
+		}).Result()
+		if err != nil && err != redis.Nil {
+			return nil, fmt.Errorf("error fetching pending messages of group %s on stream %s: %v", consumerGroup, streamKey, err)
+		}
+		now := time.Now()
+		for _, entry := range pending {
+			// idle is filtered here rather than with XPENDING IDLE, which needs Redis 6.2
+			if entry.Idle < filter.MinIdle {
+				continue
+			}
+			entries = append(entries, PendingEntryInfo{
+				ID:            entry.ID,
+				Consumer:      entry.Consumer,
+				DeliveryTime:  now.Add(-entry.Idle),
+				DeliveryCount: entry.RetryCount,
+			})
+			if filter.Count > 0 && int64(len(entries)) == filter.Count {
+				return entries, nil
+			}
+		}
+		if len(pending) < pendingPageSize {
+			return entries, nil
+		}
+		start, err = nextStreamID(pending[len(pending)-1].ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// ClaimMessagesByID claims the given pending messages for this client's consumer, whatever their idle time,
+// and returns them. Messages that are not pending anymore are skipped
+// it requires the following parameters:
+// streamKey: the stream key to claim messages from
+// consumerGroup: the consumer group to claim messages from
+// messageIDs: the IDs of the messages to claim
+func (r *RedisStreamsClient) ClaimMessagesByID(ctx context.Context, streamKey string, consumerGroup string, messageIDs []string) ([]RedisStreamsMessage, error) {
+	return r.ClaimMessagesTo(ctx, streamKey, consumerGroup, r.Config.ConsumerName, messageIDs)
+}
+
+// ClaimMessagesTo claims the given pending messages for any consumer of the group, whatever their idle time,
+// and returns them. Messages that are not pending anymore are skipped
+// it requires the following parameters:
+// streamKey: the stream key to claim messages from
+// consumerGroup: the consumer group to claim messages from
+// consumerName: the consumer the messages are assigned to
+// messageIDs: the IDs of the messages to claim
+func (r *RedisStreamsClient) ClaimMessagesTo(ctx context.Context, streamKey string, consumerGroup string, consumerName string, messageIDs []string) (claimedMessages []RedisStreamsMessage, err error) {
+	start := time.Now()
+	defer func() {
+		r.observeOperation(OperationClaim, streamKey, consumerGroup, len(claimedMessages), start, err)
+	}()
+	if len(messageIDs) == 0 {
+		return []RedisStreamsMessage{}, nil
+	}
+	if consumerName == "" {
+		return nil, fmt.Errorf("consumer name cannot be empty")
+	}
+	claimed, err := r.client.XClaim(ctx, &redis.XClaimArgs{
+		Stream:   streamKey,
+		Group:    consumerGroup,
+		Consumer: consumerName,
+		Messages: messageIDs,
+	}).Result()
+	if err != nil {
+		return nil, fmt.Errorf("error claiming messages: %v", err)
+	}
+	claimedMessages = make([]RedisStreamsMessage, 0, len(claimed))
+	for i := range claimed {
+		message := r.streamMessage(streamKey, &claimed[i])
+		message.ConsumerGroup = consumerGroup
+		message.ConsumerName = consumerName
+		claimedMessages = append(claimedMessages, message)
+	}
+	log.Printf("Consumer %s claimed %d of %d messages on group %s\n", consumerName, len(claimedMessages), len(messageIDs), consumerGroup)
+	return claimedMessages, nil
+}
+
+// ForceAck acks the given messages whoever owns them, in chunks of XACK calls, and returns the number of messages
+// that were pending. Use it to drop entries that can never be processed
+// it requires the following parameters:
+// streamKey: the stream key of the consumer group
+// consumerGroup: the consumer group to ack the messages for
+// messageIDs: the IDs of the messages to ack
+func (r *RedisStreamsClient) ForceAck(ctx context.Context, streamKey string, consumerGroup string, messageIDs []string) (int64, error) {
+	acked := int64(0)
+	for start := 0; start < len(messageIDs); start += pendingPageSize {
+		end := start + pendingPageSize
+		if end > len(messageIDs) {
+			end = len(messageIDs)
+		}
+		count, err := r.AckMessages(ctx, streamKey, consumerGroup, messageIDs[start:end]...)
+		if err != nil {
+			return acked, err
+		}
+		acked += count
+	}
+	return acked, nil
+}
+
+// MovePendingToDeadLetter copies pending messages to a dead letter stream, with the reason and their origin added as
+// fields, and acks them. Each message is copied and acked in one step with ProduceAndAck, so a message is never lost
+// nor copied twice. Messages that are not pending are skipped. It returns the IDs of the messages moved.
+// In cluster mode the dead letter stream must share a hash slot with the stream
+// it requires the following parameters:
+// streamKey: the stream key of the consumer group
+// consumerGroup: the consumer group the messages are pending in
+// deadLetterStream: the stream the messages are copied to
+// reason: why the messages were moved, stored in the dlq_reason field
+// messageIDs: the IDs of the messages to move
+func (r *RedisStreamsClient) MovePendingToDeadLetter(ctx context.Context, streamKey string, consumerGroup string,
+	deadLetterStream string, reason string, messageIDs []string) ([]string, error) {
+	if deadLetterStream == "" {
+		return nil, fmt.Errorf("dead letter stream name cannot be empty")
+	}
+	moved := make([]string, 0, len(messageIDs))
+	for _, id := range messageIDs {
+		pending, err := r.client.XPendingExt(ctx, &redis.XPendingExtArgs{
+			Stream: streamKey,
+			Group:  consumerGroup,
+			Start:  id,
+			End:    id,
+			Count:  1,
+		}).Result()
+		if err != nil && err != redis.Nil {
+			return moved, fmt.Errorf("error fetching pending message %s: %v", id, err)
+		}
+		if len(pending) == 0 {
+			log.Printf("Message %s is not pending on group %s of stream %s, not moving it\n", id, consumerGroup, streamKey)
+			continue
+		}
+		// the entry may have been trimmed or deleted while pending, its origin is still recorded
+		msg := RedisStreamsMessage{ID: id, StreamName: streamKey, ConsumerGroup: consumerGroup, ConsumerName: pending[0].Consumer}
+		entries, err := r.ReadRange(ctx, streamKey, id, id, 1)
+		if err != nil {
+			return moved, err
+		}
+		if len(entries) == 1 {
+			msg.Properties = entries[0].Properties
+		}
+		_, err = r.ProduceAndAck(ctx, msg, []RedisStreamsMessage{{StreamName: deadLetterStream, Properties: deadLetterPayload(msg, reason)}})
+		if err != nil {
+			return moved, fmt.Errorf("error moving message %s to dead letter stream %s: %v", id, deadLetterStream, err)
+		}
+		log.Printf("Moved message %s from stream %s to dead letter stream %s: %s\n", id, streamKey, deadLetterStream, reason)
+		moved = append(moved, id)
+	}
+	return moved, nil
+}
@@ -0,0 +1,141 @@
+package rediswrapper
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/a-agmon/redis-streams-wrapper/generate"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPendingMessagesAndClaimByID(t *testing.T) {
+	ctx := context.Background()
+	stream := generate.RandomStringWithPrefix("PENDSTREAM")
+	group := generate.RandomStringWithPrefix("PENDGROUP")
+	owner := newTestClient(t, "pending-owner")
+	produceMessagesTo(t, owner, stream, 3)
+	fetched, err := owner.FetchNewMessages(ctx, stream, group, 10, 1)
+	if err != nil {
+		t.Fatalf("Error polling for new messages: %v", err)
+	}
+	pending, err := owner.PendingMessages(ctx, stream, group, 10)
+	if err != nil {
+		t.Fatalf("Error listing pending messages: %v", err)
+	}
+	assert.EqualValues(t, 3, len(pending))
+	assert.EqualValues(t, fetched[0].ID, pending[0].ID)
+	assert.EqualValues(t, "pending-owner", pending[0].Consumer)
+	assert.EqualValues(t, 1, pending[0].DeliveryCount)
+
+	other := newTestClient(t, "pending-claimer")
+	claimed, err := other.ClaimMessagesByID(ctx, stream, group, []string{fetched[1].ID})
+	if err != nil {
+		t.Fatalf("Error claiming messages: %v", err)
+	}
+	assert.EqualValues(t, 1, len(claimed))
+	assert.EqualValues(t, fetched[1].ID, claimed[0].ID)
+	assert.EqualValues(t, fetched[1].Properties, claimed[0].Properties)
+	pending, err = owner.PendingMessages(ctx, stream, group, 10)
+	if err != nil {
+		t.Fatalf("Error listing pending messages: %v", err)
+	}
+	assert.EqualValues(t, "pending-claimer", pending[1].Consumer)
+}
+
+func TestListPendingFilters(t *testing.T) {
+	ctx := context.Background()
+	stream := generate.RandomStringWithPrefix("PENDSTREAM")
+	group := generate.RandomStringWithPrefix("PENDGROUP")
+	// a server of its own, since idle times are controlled by setting its clock
+	s := miniredis.RunT(t)
+	first := NewRedisClientWrapper(RedisClientConfig{Addr: s.Addr(), ConsumerName: "pending-first"})
+	defer first.CloseConnection()
+	second := NewRedisClientWrapper(RedisClientConfig{Addr: s.Addr(), ConsumerName: "pending-second"})
+	defer second.CloseConnection()
+	addEntriesWithIDs(t, first, stream, "1000-0", "2000-0", "3000-0", "4000-0")
+	now := time.Now()
+	s.SetTime(now)
+	_, err := first.FetchNewMessages(ctx, stream, group, 2, 1)
+	if err != nil {
+		t.Fatalf("Error polling for new messages: %v", err)
+	}
+	s.SetTime(now.Add(time.Minute))
+	_, err = second.FetchNewMessages(ctx, stream, group, 2, 1)
+	if err != nil {
+		t.Fatalf("Error polling for new messages: %v", err)
+	}
+
+	pendingIDs := func(filter PendingFilter) []string {
+		entries, err := first.ListPending(ctx, stream, group, filter)
+		if err != nil {
+			t.Fatalf("Error listing pending messages: %v", err)
+		}
+		ids := make([]string, 0, len(entries))
+		for _, entry := range entries {
+			ids = append(ids, entry.ID)
+		}
+		return ids
+	}
+	assert.EqualValues(t, []string{"1000-0", "2000-0", "3000-0", "4000-0"}, pendingIDs(PendingFilter{}))
+	assert.EqualValues(t, []string{"3000-0", "4000-0"}, pendingIDs(PendingFilter{Consumer: "pending-second"}))
+	assert.EqualValues(t, []string{"1000-0", "2000-0"}, pendingIDs(PendingFilter{MinIdle: 30 * time.Second}))
+	assert.EqualValues(t, []string{"2000-0", "3000-0"}, pendingIDs(PendingFilter{StreamRange: StreamRange{Start: "2000", End: "3000"}}))
+	assert.EqualValues(t, []string{"1000-0"}, pendingIDs(PendingFilter{Count: 1}))
+}
+
+func TestClaimForceAckAndDeadLetter(t *testing.T) {
+	ctx := context.Background()
+	stream := generate.RandomStringWithPrefix("PENDSTREAM")
+	group := generate.RandomStringWithPrefix("PENDGROUP")
+	dlq := generate.RandomStringWithPrefix("PENDDLQ")
+	c := newTestClient(t, "pending-operator")
+	addEntriesWithIDs(t, c, stream, "1000-0", "2000-0", "3000-0", "4000-0")
+	_, err := c.FetchNewMessages(ctx, stream, group, 10, 1)
+	if err != nil {
+		t.Fatalf("Error polling for new messages: %v", err)
+	}
+
+	claimed, err := c.ClaimMessagesTo(ctx, stream, group, "pending-worker", []string{"1000-0", "2000-0"})
+	if err != nil {
+		t.Fatalf("Error claiming messages: %v", err)
+	}
+	assert.EqualValues(t, "pending-worker", claimed[0].ConsumerName)
+	entries, err := c.ListPending(ctx, stream, group, PendingFilter{Consumer: "pending-worker"})
+	if err != nil {
+		t.Fatalf("Error listing pending messages: %v", err)
+	}
+	assert.EqualValues(t, 2, len(entries))
+
+	acked, err := c.ForceAck(ctx, stream, group, []string{"1000-0", "9000-0"})
+	if err != nil {
+		t.Fatalf("Error acking messages: %v", err)
+	}
+	assert.EqualValues(t, 1, acked)
+
+	moved, err := c.MovePendingToDeadLetter(ctx, stream, group, dlq, "poison message", []string{"1000-0", "2000-0", "3000-0"})
+	if err != nil {
+		t.Fatalf("Error moving messages to dead letter stream: %v", err)
+	}
+	assert.EqualValues(t, []string{"2000-0", "3000-0"}, moved)
+	deadLetters, err := c.ReadRange(ctx, dlq, "-", "+", 0)
+	if err != nil {
+		t.Fatalf("Error reading dead letter stream: %v", err)
+	}
+	assert.EqualValues(t, 2, len(deadLetters))
+	assert.EqualValues(t, map[string]interface{}{
+		"index":                 "1",
+		DeadLetterReasonField:   "poison message",
+		DeadLetterStreamField:   stream,
+		DeadLetterIDField:       "2000-0",
+		DeadLetterGroupField:    group,
+		DeadLetterConsumerField: "pending-worker",
+	}, deadLetters[0].Properties)
+	remaining, err := c.ListPending(ctx, stream, group, PendingFilter{})
+	if err != nil {
+		t.Fatalf("Error listing pending messages: %v", err)
+	}
+	assert.EqualValues(t, 1, len(remaining))
+	assert.EqualValues(t, "4000-0", remaining[0].ID)
+}
@@ -0,0 +1,109 @@
+package rediswrapper
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// TransformFunc turns a consumed message into the messages to produce downstream, each to its StreamName.
+// Returning no messages just acks the source message, returning an error leaves it pending
+type TransformFunc func(ctx context.Context, msg RedisStreamsMessage) ([]RedisStreamsMessage, error)
+
+// produceAndAckScript adds the output entries and acks the source message in one step, so a crash can't leave
+// one without the other. It writes nothing unless the source message is still pending for this consumer,
+// so a message reclaimed by another consumer mid processing is not produced twice, and every output has fields.
+// The last key is the source stream, ARGV starts with the group, message ID and consumer, followed by
+// the fields of every output as multiXAddScript expects them
+var produceAndAckScript = redis.NewScript(`
+local source = KEYS[#KEYS]
+local pending = redis.call('XPENDING', source, ARGV[1], ARGV[2], ARGV[2], 1)
+if #pending == 0 or pending[1][2] ~= ARGV[3] then
+	return redis.error_reply('NOTPENDING message ' .. ARGV[2] .. ' is not pending for consumer ' .. ARGV[3])
+end
+local check = 4
+for i = 1, #KEYS - 1 do
+	local keyType = redis.call('TYPE', KEYS[i])['ok']
+	if keyType ~= 'stream' and keyType ~= 'none' then
+		return redis.error_reply('WRONGTYPE key ' .. KEYS[i] .. ' holds a ' .. keyType .. ' and not a stream')
+	end
+	local fieldCount = tonumber(ARGV[check])
+	if fieldCount == nil or fieldCount < 1 then
+		return redis.error_reply('EMPTYPAYLOAD message for key ' .. KEYS[i] .. ' has no fields')
+	end
+	check = check + fieldCount * 2 + 1
+end
+local ids = {}
+local pos = 4
+for i = 1, #KEYS - 1 do
+	local fieldCount = tonumber(ARGV[pos])
+	local fields = {}
+	for j = 1, fieldCount * 2 do
+		fields[j] = ARGV[pos + j]
+	end
+	pos = pos + fieldCount * 2 + 1
+	ids[i] = redis.call('XADD', KEYS[i], '*', unpack(fields))
+end
+redis.call('XACK', source, ARGV[1], ARGV[2])
+return ids
+`)
+
+// ProduceAndAck produces the outputs derived from a consumed message and acks that message in a single script,
+// so either both happen or neither does. It fails without writing anything if the message is no longer pending
+// for this consumer, e.g. because it was reclaimed by another one.
+// In cluster mode the source and output streams must share a hash slot
+// it requires the following parameters:
+// source: the consumed message, as returned by FetchNewMessages or ClaimMessagesNotAcked
+// outputs: the messages to produce, their StreamName must be set
+func (r *RedisStreamsClient) ProduceAndAck(ctx context.Context, source RedisStreamsMessage, outputs []RedisStreamsMessage) ([]string, error) {
+	streams := []string{source.StreamName}
+	messages := make([]RedisStreamsMessage, 0, len(outputs))
+	for _, output := range outputs {
+		if output.StreamName == "" {
+			return nil, fmt.Errorf("stream name cannot be empty")
+		}
+		if len(output.Properties) == 0 {
+			return nil, fmt.Errorf("payload of output for stream %s cannot be empty", output.StreamName)
+		}
+		streams = append(streams, output.StreamName)
+		messages = append(messages, RedisStreamsMessage{StreamName: output.StreamName, Properties: copyPayload(output.Properties)})
+	}
+	if r.Config.ClusterMode {
+		if same, slots := sameSlot(streams); !same {
+			return nil, fmt.Errorf("cannot produce and ack atomically in cluster mode, streams %v map to hash slots %v: "+
+				"use the same hash tag in all stream names", streams, slots)
+		}
+	}
+	consumer := source.ConsumerName
+	if consumer == "" {
+		consumer = r.Config.ConsumerName
+	}
+	ids, err := r.produceWith(ctx, messages, func(ctx context.Context, messages []RedisStreamsMessage) ([]string, error) {
+		return r.runXAddScript(ctx, produceAndAckScript, messages, []string{source.StreamName},
+			[]interface{}{source.ConsumerGroup, source.ID, consumer})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error producing and acking message %s: %v", source.ID, err)
+	}
+	return ids, nil
+}
+
+// Process creates a Subscription that runs transform on every message and commits its outputs together with
+// the ack of the message using ProduceAndAck, for effectively once processing from stage to stage.
+// Middlewares added with Use wrap the whole transform and commit step
+// it requires the following parameters:
+// config: the stream, consumer group and polling settings of the subscription
+// transform: the function deriving the outputs of every fetched or reclaimed message
+func (r *RedisStreamsClient) Process(config SubscriptionConfig, transform TransformFunc) *Subscription {
+	sub := r.Subscribe(config, func(ctx context.Context, msg RedisStreamsMessage) error {
+		outputs, err := transform(ctx, msg)
+		if err != nil {
+			return err
+		}
+		_, err = r.ProduceAndAck(ctx, msg, outputs)
+		return err
+	})
+	sub.handlerAcks = true
+	return sub
+}
@@ -0,0 +1,147 @@
+package rediswrapper
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/a-agmon/redis-streams-wrapper/generate"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProduceAndAck(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t, "stage-consumer")
+	source := generate.RandomStringWithPrefix("STAGEIN")
+	output := generate.RandomStringWithPrefix("STAGEOUT")
+	group := generate.RandomStringWithPrefix("STAGEGROUP")
+	produceMessagesTo(t, c, source, 1)
+	messages, err := c.FetchNewMessages(ctx, source, group, 10, 1)
+	if err != nil {
+		t.Fatalf("Error polling for new messages: %v", err)
+	}
+	ids, err := c.ProduceAndAck(ctx, messages[0], []RedisStreamsMessage{
+		{StreamName: output, Properties: map[string]interface{}{"derived": "yes"}},
+		{StreamName: output, Properties: map[string]interface{}{"derived": "again"}},
+	})
+	if err != nil {
+		t.Fatalf("Error producing and acking: %v", err)
+	}
+	assert.EqualValues(t, 2, len(ids))
+	length, err := c.client.XLen(ctx, output).Result()
+	if err != nil {
+		t.Fatalf("Error reading stream length: %v", err)
+	}
+	assert.EqualValues(t, 2, length)
+	pending, err := c.client.XPending(ctx, source, group).Result()
+	if err != nil {
+		t.Fatalf("Error reading pending entries: %v", err)
+	}
+	assert.EqualValues(t, 0, pending.Count)
+
+	// the message is no longer pending, so committing it again writes nothing
+	_, err = c.ProduceAndAck(ctx, messages[0], []RedisStreamsMessage{
+		{StreamName: output, Properties: map[string]interface{}{"derived": "duplicate"}},
+	})
+	assert.ErrorContains(t, err, "NOTPENDING")
+	length, err = c.client.XLen(ctx, output).Result()
+	if err != nil {
+		t.Fatalf("Error reading stream length: %v", err)
+	}
+	assert.EqualValues(t, 2, length)
+}
+
+func TestProduceAndAckAfterReclaim(t *testing.T) {
+	ctx := context.Background()
+	source := generate.RandomStringWithPrefix("STAGEIN")
+	output := generate.RandomStringWithPrefix("STAGEOUT")
+	group := generate.RandomStringWithPrefix("STAGEGROUP")
+	slow := newTestClient(t, "slow-consumer")
+	produceMessagesTo(t, slow, source, 1)
+	messages, err := slow.FetchNewMessages(ctx, source, group, 10, 1)
+	if err != nil {
+		t.Fatalf("Error polling for new messages: %v", err)
+	}
+	// another consumer takes the message over while the slow one is still transforming it
+	other := newTestClient(t, "other-consumer")
+	claimed, err := other.ClaimMessagesNotAcked(ctx, source, group, 10, 0)
+	if err != nil {
+		t.Fatalf("Error claiming messages: %v", err)
+	}
+	assert.EqualValues(t, 1, len(claimed))
+	_, err = slow.ProduceAndAck(ctx, messages[0], []RedisStreamsMessage{
+		{StreamName: output, Properties: map[string]interface{}{"derived": "yes"}},
+	})
+	assert.Error(t, err)
+	exists, err := slow.client.Exists(ctx, output).Result()
+	if err != nil {
+		t.Fatalf("Error checking stream: %v", err)
+	}
+	assert.EqualValues(t, 0, exists)
+}
+
+func TestProcess(t *testing.T) {
+	c := newTestClient(t, "stage-consumer")
+	source := generate.RandomStringWithPrefix("STAGEIN")
+	output := generate.RandomStringWithPrefix("STAGEOUT")
+	group := generate.RandomStringWithPrefix("STAGEGROUP")
+	produceMessagesTo(t, c, source, 4)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sub := c.Process(SubscriptionConfig{StreamName: source, ConsumerGroup: group, WaitForSeconds: 1},
+		func(ctx context.Context, msg RedisStreamsMessage) ([]RedisStreamsMessage, error) {
+			return []RedisStreamsMessage{{
+				StreamName: output,
+				Properties: map[string]interface{}{"source_id": msg.ID},
+			}}, nil
+		})
+	done := make(chan error)
+	go func() {
+		done <- sub.Run(ctx)
+	}()
+	assert.Eventually(t, func() bool { return sub.Stats().Processed == 4 }, 5*time.Second, 10*time.Millisecond)
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Error running subscription: %v", err)
+	}
+	entries, err := c.client.XRange(context.Background(), output, "-", "+").Result()
+	if err != nil {
+		t.Fatalf("Error reading stream: %v", err)
+	}
+	assert.EqualValues(t, 4, len(entries))
+	assert.True(t, strings.Contains(entries[0].Values["source_id"].(string), "-"))
+	pending, err := c.client.XPending(context.Background(), source, group).Result()
+	if err != nil {
+		t.Fatalf("Error reading pending entries: %v", err)
+	}
+	assert.EqualValues(t, 0, pending.Count)
+}
+
+func TestProduceAndAckRejectsEmptyOutputs(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t, "stage-consumer")
+	source := generate.RandomStringWithPrefix("STAGEIN")
+	output := generate.RandomStringWithPrefix("STAGEOUT")
+	group := generate.RandomStringWithPrefix("STAGEGROUP")
+	messages := fetchPending(t, c, source, group, 1)
+	_, err := c.ProduceAndAck(ctx, messages[0], []RedisStreamsMessage{
+		{StreamName: output, Properties: map[string]interface{}{"derived": "yes"}},
+		{StreamName: output, Properties: map[string]interface{}{}},
+	})
+	assert.ErrorContains(t, err, "cannot be empty")
+	// the script rejects it as well, before writing or acking anything
+	_, err = produceAndAckScript.Run(ctx, c.client, []string{output, output, source},
+		group, messages[0].ID, "stage-consumer", 1, "derived", "yes", 0).Result()
+	assert.ErrorContains(t, err, "EMPTYPAYLOAD")
+	length, err := c.client.XLen(ctx, output).Result()
+	if err != nil {
+		t.Fatalf("Error reading stream length: %v", err)
+	}
+	assert.EqualValues(t, 0, length)
+	pending, err := c.PendingMessages(ctx, source, group, 10)
+	if err != nil {
+		t.Fatalf("Error listing pending messages: %v", err)
+	}
+	assert.EqualValues(t, 1, len(pending))
+}
@@ -0,0 +1,233 @@
+package rediswrapper
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ProduceFunc writes messages to their streams and returns the IDs of the new entries, in order.
+// Each message is produced to its StreamName with its Properties as payload, and its ID if one is set
+type ProduceFunc func(ctx context.Context, messages []RedisStreamsMessage) ([]string, error)
+
+// ProducerInterceptor wraps the produce path of a client, it runs for single, batch and async produce calls.
+// Interceptors may modify the messages they receive, the caller's payload maps are never modified
+type ProducerInterceptor func(next ProduceFunc) ProduceFunc
+
+// producer holds the interceptors and async state of a client
+type producer struct {
+	interceptors []ProducerInterceptor
+	async        sync.WaitGroup
+}
+
+// UseProducerInterceptors adds interceptors to the produce path of the client. Interceptors run in the order they
+// were added, the first one being the outermost. It must be called before the client starts producing
+func (r *RedisStreamsClient) UseProducerInterceptors(interceptors ...ProducerInterceptor) {
+	r.producer.interceptors = append(r.producer.interceptors, interceptors...)
+}
+
+// ProduceMessages produces a batch of messages to the given stream in a single round trip and returns their IDs
+// it requires the following parameters:
+// streamKey: the stream key to produce the messages to
+// payloads: the payloads of the messages, in order
+func (r *RedisStreamsClient) ProduceMessages(ctx context.Context, streamKey string, payloads []map[string]interface{}) ([]string, error) {
+	messages := make([]RedisStreamsMessage, 0, len(payloads))
+	for _, payload := range payloads {
+		messages = append(messages, RedisStreamsMessage{StreamName: streamKey, Properties: copyPayload(payload)})
+	}
+	ids, err := r.produce(ctx, messages)
+	if err != nil {
+		return ids, fmt.Errorf("error producing messages: %v", err)
+	}
+	return ids, nil
+}
+
+// ProduceMessageAsync produces a message in the background and returns immediately.
+// onResult is optional and is called with the new entry ID or the error once the message was produced.
+// Use FlushAsync to wait for all async messages, e.g. before shutting down.
+// Once the client is shut down the message is not produced and onResult is called with an error
+func (r *RedisStreamsClient) ProduceMessageAsync(ctx context.Context, streamKey string, payload map[string]interface{}, onResult func(id string, err error)) {
+	messages := []RedisStreamsMessage{{StreamName: streamKey, Properties: copyPayload(payload)}}
+	if err := r.lifecycle.addAsync(&r.producer.async); err != nil {
+		log.Printf("Error producing async message to stream %s: %v\n", streamKey, err)
+		if onResult != nil {
+			onResult("", fmt.Errorf("error producing async message to stream %s: %v", streamKey, err))
+		}
+		return
+	}
+	go func() {
+		defer r.producer.async.Done()
+		ids, err := r.produce(ctx, messages)
+		if err != nil {
+			log.Printf("Error producing async message to stream %s: %v\n", streamKey, err)
+		}
+		if onResult != nil {
+			id := ""
+			if len(ids) == 1 {
+				id = ids[0]
+			}
+			onResult(id, err)
+		}
+	}()
+}
+
+// FlushAsync waits until every message passed to ProduceMessageAsync was produced, or until the context is done
+func (r *RedisStreamsClient) FlushAsync(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		r.producer.async.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("error flushing async messages: %v", ctx.Err())
+	}
+}
+
+// produce runs messages through the interceptors and writes them to Redis
+func (r *RedisStreamsClient) produce(ctx context.Context, messages []RedisStreamsMessage) ([]string, error) {
+	return r.produceWith(ctx, messages, r.xadd)
+}
+
+// produceWith runs messages through the interceptors and hands them to write, the last step of the produce path
+func (r *RedisStreamsClient) produceWith(ctx context.Context, messages []RedisStreamsMessage, write ProduceFunc) ([]string, error) {
+	produceFunc := write
+	for i := len(r.producer.interceptors) - 1; i >= 0; i-- {
+		produceFunc = r.producer.interceptors[i](produceFunc)
+	}
+	return produceFunc(ctx, messages)
+}
+
+// xadd is the last step of the produce path, it writes the messages with a single XADD or a pipeline of them
+func (r *RedisStreamsClient) xadd(ctx context.Context, messages []RedisStreamsMessage) ([]string, error) {
+	start := time.Now()
+	spans := make([]trace.Span, len(messages))
+	cmds := make([]*redis.StringCmd, len(messages))
+	if len(messages) == 1 {
+		spanCtx, span, payload := r.startProducerSpan(ctx, messages[0].StreamName, messages[0].Properties)
+		spans[0] = span
+		cmds[0] = r.client.XAdd(spanCtx, xAddArgs(messages[0], payload))
+	} else {
+		pipe := r.client.Pipeline()
+		for i, message := range messages {
+			_, span, payload := r.startProducerSpan(ctx, message.StreamName, message.Properties)
+			spans[i] = span
+			cmds[i] = pipe.XAdd(ctx, xAddArgs(message, payload))
+		}
+		// errors are checked per command below
+		_, _ = pipe.Exec(ctx)
+	}
+	ids := make([]string, len(messages))
+	perStream := make(map[string]int)
+	var firstErr error
+	for i, cmd := range cmds {
+		id, err := cmd.Result()
+		if err == nil {
+			ids[i] = id
+			spans[i].SetAttributes(attribute.String("messaging.message.id", id))
+			log.Printf("Produced message %s to stream: %s\n", id, messages[i].StreamName)
+		} else if firstErr == nil {
+			firstErr = err
+		}
+		endSpan(spans[i], err)
+		perStream[messages[i].StreamName]++
+	}
+	for stream, count := range perStream {
+		r.observeOperation(OperationProduce, stream, "", count, start, firstErr)
+	}
+	return ids, firstErr
+}
+
+func xAddArgs(message RedisStreamsMessage, payload map[string]interface{}) *redis.XAddArgs {
+	return &redis.XAddArgs{
+		Stream: message.StreamName,
+		ID:     message.ID,
+		Values: payload,
+	}
+}
+
+func copyPayload(payload map[string]interface{}) map[string]interface{} {
+	payloadCopy := make(map[string]interface{}, len(payload))
+	for key, value := range payload {
+		payloadCopy[key] = value
+	}
+	return payloadCopy
+}
+
+// HeadersInterceptor stamps the given fields on every produced message, without overriding fields set by the caller
+func HeadersInterceptor(headers map[string]interface{}) ProducerInterceptor {
+	return func(next ProduceFunc) ProduceFunc {
+		return func(ctx context.Context, messages []RedisStreamsMessage) ([]string, error) {
+			for _, message := range messages {
+				for key, value := range headers {
+					if _, ok := message.Properties[key]; !ok {
+						message.Properties[key] = value
+					}
+				}
+			}
+			return next(ctx, messages)
+		}
+	}
+}
+
+// ValidationInterceptor rejects the whole call, before anything is written, if validate returns an error for any message
+func ValidationInterceptor(validate func(message RedisStreamsMessage) error) ProducerInterceptor {
+	return func(next ProduceFunc) ProduceFunc {
+		return func(ctx context.Context, messages []RedisStreamsMessage) ([]string, error) {
+			for _, message := range messages {
+				if err := validate(message); err != nil {
+					return make([]string, len(messages)), fmt.Errorf("invalid message for stream %s: %v", message.StreamName, err)
+				}
+			}
+			return next(ctx, messages)
+		}
+	}
+}
+
+// MaxPayloadSizeInterceptor rejects messages whose field names and values add up to more than maxBytes
+func MaxPayloadSizeInterceptor(maxBytes int) ProducerInterceptor {
+	return ValidationInterceptor(func(message RedisStreamsMessage) error {
+		size := payloadSize(message.Properties)
+		if size > maxBytes {
+			return fmt.Errorf("payload of %d bytes exceeds the limit of %d bytes", size, maxBytes)
+		}
+		return nil
+	})
+}
+
+// payloadString returns a payload field as a string, or an empty string if the field is missing
+func payloadString(payload map[string]interface{}, key string) string {
+	value, ok := payload[key]
+	if !ok || value == nil {
+		return ""
+	}
+	if s, ok := value.(string); ok {
+		return s
+	}
+	return fmt.Sprint(value)
+}
+
+// payloadSize approximates the size of a payload as Redis stores it, the length of every field name and value
+func payloadSize(payload map[string]interface{}) int {
+	size := 0
+	for key, value := range payload {
+		size += len(key)
+		switch v := value.(type) {
+		case string:
+			size += len(v)
+		case []byte:
+			size += len(v)
+		default:
+			size += len(fmt.Sprint(v))
+		}
+	}
+	return size
+}
@@ -0,0 +1,96 @@
+package rediswrapper
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/a-agmon/redis-streams-wrapper/generate"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProduceMessagesBatch(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t, "batch-producer")
+	stream := generate.RandomStringWithPrefix("PRODSTREAM")
+	ids, err := c.ProduceMessages(ctx, stream, []map[string]interface{}{{"index": 0}, {"index": 1}, {"index": 2}})
+	if err != nil {
+		t.Fatalf("Error producing messages: %v", err)
+	}
+	assert.EqualValues(t, 3, len(ids))
+	entries, err := c.client.XRange(ctx, stream, "-", "+").Result()
+	if err != nil {
+		t.Fatalf("Error reading stream: %v", err)
+	}
+	for i, entry := range entries {
+		assert.EqualValues(t, ids[i], entry.ID)
+	}
+}
+
+func TestProducerInterceptorsApplyToAllProducePaths(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t, "intercepted-producer")
+	stream := generate.RandomStringWithPrefix("PRODSTREAM")
+	var mu sync.Mutex
+	intercepted := 0
+	counter := func(next ProduceFunc) ProduceFunc {
+		return func(ctx context.Context, messages []RedisStreamsMessage) ([]string, error) {
+			mu.Lock()
+			intercepted += len(messages)
+			mu.Unlock()
+			return next(ctx, messages)
+		}
+	}
+	c.UseProducerInterceptors(counter, HeadersInterceptor(map[string]interface{}{"source": "billing"}))
+
+	payload := map[string]interface{}{"kind": "single"}
+	err := c.ProduceMessage(ctx, stream, payload)
+	if err != nil {
+		t.Fatalf("Error producing message: %v", err)
+	}
+	assert.EqualValues(t, map[string]interface{}{"kind": "single"}, payload)
+	_, err = c.ProduceMessages(ctx, stream, []map[string]interface{}{{"kind": "batch"}, {"kind": "batch", "source": "override"}})
+	if err != nil {
+		t.Fatalf("Error producing messages: %v", err)
+	}
+	asyncErr := make(chan error, 1)
+	c.ProduceMessageAsync(ctx, stream, map[string]interface{}{"kind": "async"}, func(id string, err error) {
+		asyncErr <- err
+	})
+	flushCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	err = c.FlushAsync(flushCtx)
+	if err != nil {
+		t.Fatalf("Error flushing async messages: %v", err)
+	}
+	assert.NoError(t, <-asyncErr)
+
+	assert.EqualValues(t, 4, intercepted)
+	entries, err := c.client.XRange(ctx, stream, "-", "+").Result()
+	if err != nil {
+		t.Fatalf("Error reading stream: %v", err)
+	}
+	sources := make([]interface{}, 0)
+	for _, entry := range entries {
+		sources = append(sources, entry.Values["source"])
+	}
+	assert.EqualValues(t, []interface{}{"billing", "billing", "override", "billing"}, sources)
+}
+
+func TestMaxPayloadSizeInterceptor(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t, "limited-producer")
+	c.UseProducerInterceptors(MaxPayloadSizeInterceptor(16))
+	stream := generate.RandomStringWithPrefix("PRODSTREAM")
+	err := c.ProduceMessage(ctx, stream, map[string]interface{}{"k": "small"})
+	assert.NoError(t, err)
+	// a single oversized message rejects the whole batch before anything is written
+	_, err = c.ProduceMessages(ctx, stream, []map[string]interface{}{{"k": "small"}, {"k": "this value is far too large"}})
+	assert.Error(t, err)
+	length, err := c.client.XLen(ctx, stream).Result()
+	if err != nil {
+		t.Fatalf("Error reading stream length: %v", err)
+	}
+	assert.EqualValues(t, 1, length)
+}
@@ -0,0 +1,168 @@
+package rediswrapper
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// ReadRange reads the entries between two IDs, oldest first, without a consumer group.
+// Use StreamIDFromTime to read by the time entries were added, or IterateRange for ranges too large for one call
+// it requires the following parameters:
+// streamKey: the stream key to read from
+// from: the first ID included, - for the beginning of the stream
+// to: the last ID included, + for the end of the stream
+// count: the maximum number of entries returned, use 0 for no limit
+func (r *RedisStreamsClient) ReadRange(ctx context.Context, streamKey string, from string, to string, count int64) ([]RedisStreamsMessage, error) {
+	var entries []redis.XMessage
+	var err error
+	if count > 0 {
+		entries, err = r.client.XRangeN(ctx, streamKey, from, to, count).Result()
+	} else {
+		entries, err = r.client.XRange(ctx, streamKey, from, to).Result()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading range of stream %s: %v", streamKey, err)
+	}
+	return r.streamMessages(streamKey, entries), nil
+}
+
+// ReadRangeReverse reads the entries between two IDs, newest first, without a consumer group
+// it requires the following parameters:
+// streamKey: the stream key to read from
+// from: the first ID included, + for the end of the stream
+// to: the last ID included, - for the beginning of the stream
+// count: the maximum number of entries returned, use 0 for no limit
+func (r *RedisStreamsClient) ReadRangeReverse(ctx context.Context, streamKey string, from string, to string, count int64) ([]RedisStreamsMessage, error) {
+	var entries []redis.XMessage
+	var err error
+	if count > 0 {
+		entries, err = r.client.XRevRangeN(ctx, streamKey, from, to, count).Result()
+	} else {
+		entries, err = r.client.XRevRange(ctx, streamKey, from, to).Result()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error reading reverse range of stream %s: %v", streamKey, err)
+	}
+	return r.streamMessages(streamKey, entries), nil
+}
+
+// IteratorOptions configures a RangeIterator
+type IteratorOptions struct {
+	// PageSize is the number of entries read per call, 1000 by default
+	PageSize int64
+	// Reverse iterates newest first
+	Reverse bool
+}
+
+// RangeIterator pages through a range of stream entries, however large, reading one page at a time.
+// Call Next until it returns false, then check Err:
+//
+//	it := client.IterateRange("orders", rediswrapper.StreamRange{Since: yesterday}, rediswrapper.IteratorOptions{})
+//	for it.Next(ctx) {
+//		msg := it.Message()
+//	}
+//	if err := it.Err(); err != nil {
+//	}
+type RangeIterator struct {
+	client    *RedisStreamsClient
+	streamKey string
+	start     string
+	end       string
+	opts      IteratorOptions
+
+	page    []RedisStreamsMessage
+	pos     int
+	current RedisStreamsMessage
+	done    bool
+	err     error
+}
+
+// IterateRange returns an iterator over the entries of a stream within a range of IDs and times.
+// Entries added to the range while iterating are returned if they are not before the current position
+// it requires the following parameters:
+// streamKey: the stream key to read from
+// streamRange: the entries to iterate over, the zero value iterates over the whole stream
+// opts: the page size and direction
+func (r *RedisStreamsClient) IterateRange(streamKey string, streamRange StreamRange, opts IteratorOptions) *RangeIterator {
+	if opts.PageSize <= 0 {
+		opts.PageSize = 1000
+	}
+	it := &RangeIterator{client: r, streamKey: streamKey, opts: opts}
+	start, end, err := streamRange.bounds()
+	if err != nil {
+		it.err = fmt.Errorf("invalid range: %v", err)
+		return it
+	}
+	it.start, it.end = start, end
+	return it
+}
+
+// Next advances to the next entry, reading a new page when needed. It returns false at the end of the range or on error
+func (it *RangeIterator) Next(ctx context.Context) bool {
+	if it.pos == len(it.page) {
+		if it.done || it.err != nil {
+			return false
+		}
+		it.err = it.readPage(ctx)
+		if it.err != nil || len(it.page) == 0 {
+			return false
+		}
+	}
+	it.current = it.page[it.pos]
+	it.pos++
+	return true
+}
+
+// Message returns the current entry
+func (it *RangeIterator) Message() RedisStreamsMessage {
+	return it.current
+}
+
+// Err returns the error that stopped the iteration, if any
+func (it *RangeIterator) Err() error {
+	return it.err
+}
+
+// readPage reads the next page and moves the range past it
+func (it *RangeIterator) readPage(ctx context.Context) error {
+	var page []RedisStreamsMessage
+	var err error
+	if it.opts.Reverse {
+		page, err = it.client.ReadRangeReverse(ctx, it.streamKey, it.end, it.start, it.opts.PageSize)
+	} else {
+		page, err = it.client.ReadRange(ctx, it.streamKey, it.start, it.end, it.opts.PageSize)
+	}
+	if err != nil {
+		return err
+	}
+	it.page, it.pos = page, 0
+	if int64(len(page)) < it.opts.PageSize {
+		it.done = true
+		return nil
+	}
+	lastID := page[len(page)-1].ID
+	if !it.opts.Reverse {
+		it.start, err = nextStreamID(lastID)
+		return err
+	}
+	prev, ok, err := prevStreamID(lastID)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		it.done = true
+	}
+	it.end = prev
+	return nil
+}
+
+// streamMessages converts entries read outside of a consumer group
+func (r *RedisStreamsClient) streamMessages(streamKey string, entries []redis.XMessage) []RedisStreamsMessage {
+	messages := make([]RedisStreamsMessage, 0, len(entries))
+	for i := range entries {
+		messages = append(messages, r.streamMessage(streamKey, &entries[i]))
+	}
+	return messages
+}
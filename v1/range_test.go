@@ -0,0 +1,71 @@
+package rediswrapper
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/a-agmon/redis-streams-wrapper/generate"
+	"github.com/stretchr/testify/assert"
+)
+
+func messageIDs(messages []RedisStreamsMessage) []string {
+	ids := make([]string, 0, len(messages))
+	for _, message := range messages {
+		ids = append(ids, message.ID)
+	}
+	return ids
+}
+
+func TestReadRange(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t, "range-reader")
+	stream := generate.RandomStringWithPrefix("RANGESTREAM")
+	addEntriesWithIDs(t, c, stream, "1000-0", "1000-1", "2000-0", "3000-0")
+
+	messages, err := c.ReadRange(ctx, stream, "-", "+", 0)
+	if err != nil {
+		t.Fatalf("Error reading range: %v", err)
+	}
+	assert.EqualValues(t, []string{"1000-0", "1000-1", "2000-0", "3000-0"}, messageIDs(messages))
+	assert.EqualValues(t, stream, messages[0].StreamName)
+	messages, err = c.ReadRange(ctx, stream, "1000-1", "2000", 10)
+	if err != nil {
+		t.Fatalf("Error reading range: %v", err)
+	}
+	assert.EqualValues(t, []string{"1000-1", "2000-0"}, messageIDs(messages))
+	messages, err = c.ReadRangeReverse(ctx, stream, "+", "-", 2)
+	if err != nil {
+		t.Fatalf("Error reading reverse range: %v", err)
+	}
+	assert.EqualValues(t, []string{"3000-0", "2000-0"}, messageIDs(messages))
+}
+
+func TestIterateRange(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t, "range-reader")
+	stream := generate.RandomStringWithPrefix("RANGESTREAM")
+	addEntriesWithIDs(t, c, stream, "0-1", "1000-0", "1000-1", "2000-0", "3000-0")
+
+	collect := func(streamRange StreamRange, opts IteratorOptions) []string {
+		it := c.IterateRange(stream, streamRange, opts)
+		ids := make([]string, 0)
+		for it.Next(ctx) {
+			ids = append(ids, it.Message().ID)
+		}
+		if err := it.Err(); err != nil {
+			t.Fatalf("Error iterating range: %v", err)
+		}
+		return ids
+	}
+	all := []string{"0-1", "1000-0", "1000-1", "2000-0", "3000-0"}
+	assert.EqualValues(t, all, collect(StreamRange{}, IteratorOptions{PageSize: 2}))
+	assert.EqualValues(t, all, collect(StreamRange{}, IteratorOptions{PageSize: 5}))
+	assert.EqualValues(t, []string{"3000-0", "2000-0", "1000-1", "1000-0", "0-1"}, collect(StreamRange{}, IteratorOptions{PageSize: 2, Reverse: true}))
+	assert.EqualValues(t, []string{"1000-1", "1000-0"},
+		collect(StreamRange{Since: time.UnixMilli(1000), Until: time.UnixMilli(2000)}, IteratorOptions{PageSize: 1, Reverse: true}))
+
+	it := c.IterateRange(stream, StreamRange{Start: "nope", Since: time.Now()}, IteratorOptions{})
+	assert.False(t, it.Next(ctx))
+	assert.Error(t, it.Err())
+}
@@ -0,0 +1,138 @@
+package rediswrapper
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+)
+
+// UnknownTypePolicy decides what a Router does with messages whose type has no registered handler
+type UnknownTypePolicy int
+
+const (
+	// UnknownTypeFail returns an error, leaving the message pending
+	UnknownTypeFail UnknownTypePolicy = iota
+	// UnknownTypeAck acks and drops the message
+	UnknownTypeAck
+	// UnknownTypeDeadLetter moves the message to RouterConfig.DeadLetterStream and acks it in a single script.
+	// In cluster mode the dead letter stream must share a hash slot with the consumed streams
+	UnknownTypeDeadLetter
+)
+
+// RouterConfig describes how a Router finds the type of a message and handles unknown types
+type RouterConfig struct {
+	// TypeField is the message field holding the event type, "type" by default
+	TypeField         string
+	UnknownTypePolicy UnknownTypePolicy
+	DeadLetterStream  string
+}
+
+// Router dispatches messages to handlers registered per event type. Its Handle method is a MessageHandler,
+// so a router can be passed to Subscribe like any other handler
+type Router struct {
+	client         *RedisStreamsClient
+	config         RouterConfig
+	handlers       map[string]MessageHandler
+	defaultHandler MessageHandler
+}
+
+// NewRouter creates an empty Router, the client is used to write unknown messages to the dead letter stream.
+// It fails if the unknown type policy is UnknownTypeDeadLetter and no dead letter stream is set
+func (r *RedisStreamsClient) NewRouter(config RouterConfig) (*Router, error) {
+	if config.TypeField == "" {
+		config.TypeField = "type"
+	}
+	if config.UnknownTypePolicy == UnknownTypeDeadLetter && config.DeadLetterStream == "" {
+		return nil, fmt.Errorf("dead letter stream name cannot be empty with the dead letter policy")
+	}
+	return &Router{
+		client:   r,
+		config:   config,
+		handlers: make(map[string]MessageHandler),
+	}, nil
+}
+
+// Register sets the handler of an event type, replacing any previous one
+func (rt *Router) Register(eventType string, handler MessageHandler) *Router {
+	rt.handlers[eventType] = handler
+	return rt
+}
+
+// Default sets the handler used for event types without a registered handler, instead of the unknown type policy
+func (rt *Router) Default(handler MessageHandler) *Router {
+	rt.defaultHandler = handler
+	return rt
+}
+
+// Handle dispatches a message to the handler registered for its type
+func (rt *Router) Handle(ctx context.Context, msg RedisStreamsMessage) error {
+	eventType := payloadString(msg.Properties, rt.config.TypeField)
+	if handler, ok := rt.handlers[eventType]; ok {
+		return handler(ctx, msg)
+	}
+	if rt.defaultHandler != nil {
+		return rt.defaultHandler(ctx, msg)
+	}
+	switch rt.config.UnknownTypePolicy {
+	case UnknownTypeAck:
+		log.Printf("Dropping message %s on stream %s with unknown type %q\n", msg.ID, msg.StreamName, eventType)
+		return nil
+	case UnknownTypeDeadLetter:
+		return rt.client.moveToDeadLetter(ctx, rt.config.DeadLetterStream, msg, fmt.Sprintf("unknown message type %q", eventType))
+	default:
+		return fmt.Errorf("no handler for message type %q", eventType)
+	}
+}
+
+// Codec decodes the payload of a message into a typed value
+type Codec interface {
+	Decode(msg RedisStreamsMessage, v interface{}) error
+}
+
+// JSONCodec decodes JSON messages. If Field is set the value is read from that field, which must hold a JSON document,
+// otherwise the whole payload is decoded as a JSON object of its fields. Redis returns every field as a string,
+// so in the latter case numeric fields of the target need the `json:",string"` option
+type JSONCodec struct {
+	Field string
+}
+
+// Decode implements Codec
+func (c JSONCodec) Decode(msg RedisStreamsMessage, v interface{}) error {
+	var data []byte
+	if c.Field != "" {
+		value, ok := msg.Properties[c.Field]
+		if !ok {
+			return fmt.Errorf("message %s has no field %s", msg.ID, c.Field)
+		}
+		data = []byte(payloadString(msg.Properties, c.Field))
+		if b, ok := value.([]byte); ok {
+			data = b
+		}
+	} else {
+		var err error
+		data, err = json.Marshal(msg.Properties)
+		if err != nil {
+			return fmt.Errorf("error encoding payload of message %s: %v", msg.ID, err)
+		}
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("error decoding message %s: %v", msg.ID, err)
+	}
+	return nil
+}
+
+// TypedHandler handles a message together with its decoded payload
+type TypedHandler[T any] func(ctx context.Context, msg RedisStreamsMessage, event T) error
+
+// RegisterTyped sets the handler of an event type, decoding every message with codec before calling it.
+// A message that can't be decoded is not passed to the handler and its decoding error is returned
+func RegisterTyped[T any](rt *Router, eventType string, codec Codec, handler TypedHandler[T]) *Router {
+	return rt.Register(eventType, func(ctx context.Context, msg RedisStreamsMessage) error {
+		var event T
+		if err := codec.Decode(msg, &event); err != nil {
+			return err
+		}
+		return handler(ctx, msg, event)
+	})
+}
@@ -0,0 +1,126 @@
+package rediswrapper
+
+import (
+	"context"
+	"testing"
+
+	"github.com/a-agmon/redis-streams-wrapper/generate"
+	"github.com/stretchr/testify/assert"
+)
+
+type orderCreated struct {
+	OrderID string `json:"order_id"`
+	Amount  int    `json:"amount,string"`
+}
+
+func TestRouterDispatchesByType(t *testing.T) {
+	c := newTestClient(t, "router-consumer")
+	var created []orderCreated
+	var cancelled []string
+	router, err := c.NewRouter(RouterConfig{TypeField: "event"})
+	if err != nil {
+		t.Fatalf("Error creating router: %v", err)
+	}
+	RegisterTyped(router, "order.created", JSONCodec{}, func(ctx context.Context, msg RedisStreamsMessage, event orderCreated) error {
+		created = append(created, event)
+		return nil
+	})
+	router.Register("order.cancelled", func(ctx context.Context, msg RedisStreamsMessage) error {
+		cancelled = append(cancelled, msg.ID)
+		return nil
+	})
+
+	err = router.Handle(context.Background(), RedisStreamsMessage{ID: "1-0", Properties: map[string]interface{}{
+		"event": "order.created", "order_id": "A17", "amount": "250",
+	}})
+	assert.NoError(t, err)
+	err = router.Handle(context.Background(), RedisStreamsMessage{ID: "2-0", Properties: map[string]interface{}{"event": "order.cancelled"}})
+	assert.NoError(t, err)
+	assert.EqualValues(t, []orderCreated{{OrderID: "A17", Amount: 250}}, created)
+	assert.EqualValues(t, []string{"2-0"}, cancelled)
+
+	// unknown types fail by default so the message stays pending
+	err = router.Handle(context.Background(), RedisStreamsMessage{ID: "3-0", Properties: map[string]interface{}{"event": "order.shipped"}})
+	assert.Error(t, err)
+	// decoding errors are returned as handler errors
+	err = router.Handle(context.Background(), RedisStreamsMessage{ID: "4-0", Properties: map[string]interface{}{"event": "order.created", "amount": "many"}})
+	assert.Error(t, err)
+}
+
+func TestRouterJSONCodecField(t *testing.T) {
+	var decoded orderCreated
+	err := JSONCodec{Field: "data"}.Decode(RedisStreamsMessage{Properties: map[string]interface{}{
+		"data": `{"order_id":"A18","amount":"12"}`,
+	}}, &decoded)
+	assert.NoError(t, err)
+	assert.EqualValues(t, orderCreated{OrderID: "A18", Amount: 12}, decoded)
+}
+
+func TestRouterUnknownTypeDeadLetter(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t, "router-consumer")
+	stream := generate.RandomStringWithPrefix("ROUTERSTREAM")
+	group := generate.RandomStringWithPrefix("ROUTERGROUP")
+	deadLetterStream := stream + "-dlq"
+	err := c.ProduceMessage(ctx, stream, map[string]interface{}{"type": "mystery"})
+	if err != nil {
+		t.Fatalf("Error producing message: %v", err)
+	}
+	router, err := c.NewRouter(RouterConfig{UnknownTypePolicy: UnknownTypeDeadLetter, DeadLetterStream: deadLetterStream})
+	if err != nil {
+		t.Fatalf("Error creating router: %v", err)
+	}
+	subCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	sub := c.Subscribe(SubscriptionConfig{StreamName: stream, ConsumerGroup: group, WaitForSeconds: 1}, router.Handle)
+	sub.Use(func(next MessageHandler) MessageHandler {
+		return func(ctx context.Context, msg RedisStreamsMessage) error {
+			defer cancel()
+			return next(ctx, msg)
+		}
+	})
+	err = sub.Run(subCtx)
+	if err != nil {
+		t.Fatalf("Error running subscription: %v", err)
+	}
+	assert.EqualValues(t, 1, sub.Stats().Processed)
+	deadLetters, err := c.client.XRange(ctx, deadLetterStream, "-", "+").Result()
+	if err != nil {
+		t.Fatalf("Error reading dead letter stream: %v", err)
+	}
+	assert.EqualValues(t, 1, len(deadLetters))
+	assert.EqualValues(t, "mystery", deadLetters[0].Values["type"])
+	assert.EqualValues(t, stream, deadLetters[0].Values[DeadLetterStreamField])
+	assert.EqualValues(t, group, deadLetters[0].Values[DeadLetterGroupField])
+	assert.Contains(t, deadLetters[0].Values[DeadLetterReasonField], "mystery")
+}
+
+func TestRouterDeadLetterAcksInTheSameScript(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t, "router-consumer")
+	_, err := c.NewRouter(RouterConfig{UnknownTypePolicy: UnknownTypeDeadLetter})
+	assert.Error(t, err)
+
+	stream := generate.RandomStringWithPrefix("ROUTERSTREAM")
+	group := generate.RandomStringWithPrefix("ROUTERGROUP")
+	deadLetterStream := stream + "-dlq"
+	messages := fetchPending(t, c, stream, group, 1)
+	router, err := c.NewRouter(RouterConfig{UnknownTypePolicy: UnknownTypeDeadLetter, DeadLetterStream: deadLetterStream})
+	if err != nil {
+		t.Fatalf("Error creating router: %v", err)
+	}
+	// the message is acked by the router itself, a crash before the subscription acks it can't duplicate it
+	assert.NoError(t, router.Handle(ctx, messages[0]))
+	pending, err := c.PendingMessages(ctx, stream, group, 10)
+	if err != nil {
+		t.Fatalf("Error listing pending messages: %v", err)
+	}
+	assert.EqualValues(t, 0, len(pending))
+	// a redelivered copy is no longer pending, so it is not written again
+	assert.Error(t, router.Handle(ctx, messages[0]))
+	length, err := c.client.XLen(ctx, deadLetterStream).Result()
+	if err != nil {
+		t.Fatalf("Error reading dead letter stream length: %v", err)
+	}
+	assert.EqualValues(t, 1, length)
+}
@@ -0,0 +1,196 @@
+package rediswrapper
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// lifecycle tracks what Shutdown has to drain: running subscriptions, ack batchers and delayed requeues
+type lifecycle struct {
+	mu            sync.Mutex
+	shutdown      bool
+	subscriptions map[*Subscription]struct{}
+	ackBatchers   map[*AckBatcher]struct{}
+	timers        map[*time.Timer]struct{}
+	// scheduled counts the timers that were neither stopped nor done running
+	scheduled sync.WaitGroup
+}
+
+// register adds a running subscription, it fails once the client is shut down
+func (l *lifecycle) register(s *Subscription) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.shutdown {
+		return fmt.Errorf("client is shut down")
+	}
+	if l.subscriptions == nil {
+		l.subscriptions = make(map[*Subscription]struct{})
+	}
+	l.subscriptions[s] = struct{}{}
+	return nil
+}
+
+func (l *lifecycle) unregister(s *Subscription) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.subscriptions, s)
+}
+
+func (l *lifecycle) addAckBatcher(b *AckBatcher) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.ackBatchers == nil {
+		l.ackBatchers = make(map[*AckBatcher]struct{})
+	}
+	l.ackBatchers[b] = struct{}{}
+}
+
+// removeAckBatcher forgets a closed ack batcher, so Shutdown does not close it again
+func (l *lifecycle) removeAckBatcher(b *AckBatcher) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.ackBatchers, b)
+}
+
+// addAsync counts one more async produce in wg, it fails once the client is shut down.
+// Holding mu keeps the Add from racing with the Wait of Shutdown, which only starts once shutdown is set
+func (l *lifecycle) addAsync(wg *sync.WaitGroup) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.shutdown {
+		return fmt.Errorf("client is shut down")
+	}
+	wg.Add(1)
+	return nil
+}
+
+// afterFunc runs fn after delay unless the client is shut down first, it fails once the client is shut down
+func (l *lifecycle) afterFunc(delay time.Duration, fn func()) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.shutdown {
+		return fmt.Errorf("client is shut down")
+	}
+	if l.timers == nil {
+		l.timers = make(map[*time.Timer]struct{})
+	}
+	l.scheduled.Add(1)
+	var timer *time.Timer
+	timer = time.AfterFunc(delay, func() {
+		l.mu.Lock()
+		_, scheduled := l.timers[timer]
+		delete(l.timers, timer)
+		l.mu.Unlock()
+		// a timer stopped by Shutdown may still fire, it was already counted done
+		if scheduled {
+			defer l.scheduled.Done()
+			fn()
+		}
+	})
+	l.timers[timer] = struct{}{}
+	return nil
+}
+
+// stop marks the client shut down and returns what is left to drain. Timers that did not fire are stopped
+func (l *lifecycle) stop() ([]*Subscription, []*AckBatcher) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.shutdown = true
+	for timer := range l.timers {
+		timer.Stop()
+		delete(l.timers, timer)
+		l.scheduled.Done()
+	}
+	subscriptions := make([]*Subscription, 0, len(l.subscriptions))
+	for s := range l.subscriptions {
+		subscriptions = append(subscriptions, s)
+	}
+	ackBatchers := make([]*AckBatcher, 0, len(l.ackBatchers))
+	for b := range l.ackBatchers {
+		ackBatchers = append(ackBatchers, b)
+	}
+	return subscriptions, ackBatchers
+}
+
+// Shutdown stops the client gracefully: running subscriptions stop fetching and their in-flight handlers are
+// waited for, then the acks of every AckBatcher and the messages passed to ProduceMessageAsync are flushed,
+// and the connection is closed last. When the context is done before the handlers returned, their context is
+// cancelled and Shutdown goes on with the next steps without waiting for them.
+// Messages fetched but not handled yet stay pending, or are released when SubscriptionConfig.ReleaseOnShutdown is set,
+// and requeues delayed by Nack that are not due yet are dropped, leaving their message pending to be reclaimed
+func (r *RedisStreamsClient) Shutdown(ctx context.Context) error {
+	subscriptions, ackBatchers := r.lifecycle.stop()
+	failures := make([]string, 0)
+	var drained sync.WaitGroup
+	var mu sync.Mutex
+	for _, s := range subscriptions {
+		drained.Add(1)
+		go func(s *Subscription) {
+			defer drained.Done()
+			if err := s.Shutdown(ctx); err != nil {
+				mu.Lock()
+				defer mu.Unlock()
+				failures = append(failures, err.Error())
+			}
+		}(s)
+	}
+	drained.Wait()
+	for _, b := range ackBatchers {
+		if err := b.Close(ctx); err != nil {
+			failures = append(failures, err.Error())
+		}
+	}
+	if err := r.FlushAsync(ctx); err != nil {
+		failures = append(failures, err.Error())
+	}
+	if err := waitGroup(ctx, &r.lifecycle.scheduled); err != nil {
+		failures = append(failures, fmt.Sprintf("error waiting for requeues: %v", err))
+	}
+	if err := r.client.Close(); err != nil {
+		failures = append(failures, fmt.Sprintf("error closing redis connection: %v", err))
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("error shutting down client: %s", strings.Join(failures, "; "))
+	}
+	log.Printf("Consumer %s shut down\n", r.Config.ConsumerName)
+	return nil
+}
+
+// Shutdown stops fetching new messages and waits until the handlers in flight returned and Run returned.
+// When the context is done first, the handlers' context is cancelled and an error is returned without waiting further.
+// It does nothing if the subscription is not running
+func (s *Subscription) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	stopFetching, cancelHandlers, done := s.stopFetching, s.cancelHandlers, s.done
+	s.mu.Unlock()
+	if done == nil {
+		return nil
+	}
+	stopFetching()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		cancelHandlers()
+		return fmt.Errorf("error draining subscription on stream %s group %s: %v", s.config.StreamName, s.config.ConsumerGroup, ctx.Err())
+	}
+}
+
+// waitGroup waits for wg, or until the context is done
+func waitGroup(ctx context.Context, wg *sync.WaitGroup) error {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
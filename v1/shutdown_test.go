@@ -0,0 +1,190 @@
+package rediswrapper
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/a-agmon/redis-streams-wrapper/generate"
+	"github.com/stretchr/testify/assert"
+)
+
+// newShutdownClient creates a client that the test shuts down itself, so it is not closed on cleanup
+func newShutdownClient(consumerName string) *RedisStreamsClient {
+	return NewRedisClientWrapper(RedisClientConfig{Addr: testRedisServer.Addr(), ConsumerName: consumerName})
+}
+
+// runSubscription runs sub in the background and returns the channel receiving the result of Run
+func runSubscription(sub *Subscription) chan error {
+	result := make(chan error, 1)
+	go func() {
+		result <- sub.Run(context.Background())
+	}()
+	return result
+}
+
+func TestShutdownOnSIGTERMDrainsInFlightHandlers(t *testing.T) {
+	stream := generate.RandomStringWithPrefix("SHUTSTREAM")
+	group := generate.RandomStringWithPrefix("SHUTGROUP")
+	c := newShutdownClient("shutdown-consumer")
+	produceMessagesTo(t, c, stream, 3)
+	sigCtx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM)
+	defer stop()
+
+	var handled atomic.Int64
+	var handlerCancelled atomic.Bool
+	sub := c.Subscribe(SubscriptionConfig{StreamName: stream, ConsumerGroup: group, BatchSize: 3, WaitForSeconds: 1, ReleaseOnShutdown: true},
+		func(ctx context.Context, msg RedisStreamsMessage) error {
+			process, err := os.FindProcess(os.Getpid())
+			if err != nil {
+				return err
+			}
+			if err = process.Signal(syscall.SIGTERM); err != nil {
+				return err
+			}
+			// the handler is still busy when the shutdown starts
+			time.Sleep(200 * time.Millisecond)
+			handlerCancelled.Store(ctx.Err() != nil)
+			handled.Add(1)
+			return nil
+		})
+	result := runSubscription(sub)
+
+	// an ack and an async produce still waiting when the shutdown starts
+	acker := newTestClient(t, "shutdown-acker")
+	ackGroup := generate.RandomStringWithPrefix("SHUTGROUP")
+	toAck := fetchPending(t, acker, stream, ackGroup, 1)
+	batcher := c.NewAckBatcher(AckBatcherConfig{MaxDelay: time.Hour})
+	acked := make(chan error, 1)
+	go func() {
+		acked <- batcher.Ack(context.Background(), stream, ackGroup, toAck[0].ID)
+	}()
+	assert.Eventually(t, func() bool {
+		batcher.mu.Lock()
+		defer batcher.mu.Unlock()
+		return len(batcher.batches) == 1
+	}, time.Second, time.Millisecond)
+	asyncStream := generate.RandomStringWithPrefix("SHUTASYNC")
+
+	select {
+	case <-sigCtx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatalf("SIGTERM was not received")
+	}
+	c.ProduceMessageAsync(context.Background(), asyncStream, map[string]interface{}{"kind": "async"}, nil)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err := c.Shutdown(shutdownCtx)
+	if err != nil {
+		t.Fatalf("Error shutting down: %v", err)
+	}
+	assert.NoError(t, <-result)
+	assert.EqualValues(t, 1, handled.Load())
+	assert.False(t, handlerCancelled.Load())
+	assert.NoError(t, <-acked)
+
+	// the handled message was acked and the two that were never started were released
+	released, err := acker.ListPending(context.Background(), stream, group, PendingFilter{MinIdle: time.Hour})
+	if err != nil {
+		t.Fatalf("Error listing pending messages: %v", err)
+	}
+	assert.EqualValues(t, 2, len(released))
+	pending, err := acker.PendingMessages(context.Background(), stream, ackGroup, 10)
+	if err != nil {
+		t.Fatalf("Error listing pending messages: %v", err)
+	}
+	assert.EqualValues(t, 0, len(pending))
+	length, err := acker.client.XLen(context.Background(), asyncStream).Result()
+	if err != nil {
+		t.Fatalf("Error reading stream length: %v", err)
+	}
+	assert.EqualValues(t, 1, length)
+
+	// the client is closed and refuses new work
+	assert.Error(t, sub.Run(context.Background()))
+	assert.Error(t, c.ProduceMessage(context.Background(), stream, map[string]interface{}{"kind": "late"}))
+}
+
+func TestShutdownCancelsHandlersAfterDeadline(t *testing.T) {
+	stream := generate.RandomStringWithPrefix("SHUTSTREAM")
+	group := generate.RandomStringWithPrefix("SHUTGROUP")
+	c := newShutdownClient("shutdown-consumer")
+	produceMessagesTo(t, c, stream, 1)
+	started := make(chan struct{})
+	handlerErr := make(chan error, 1)
+	sub := c.Subscribe(SubscriptionConfig{StreamName: stream, ConsumerGroup: group, WaitForSeconds: 1},
+		func(ctx context.Context, msg RedisStreamsMessage) error {
+			close(started)
+			<-ctx.Done()
+			handlerErr <- ctx.Err()
+			return ctx.Err()
+		})
+	result := runSubscription(sub)
+	<-started
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	assert.Error(t, c.Shutdown(shutdownCtx))
+	assert.ErrorIs(t, <-handlerErr, context.Canceled)
+	assert.NoError(t, <-result)
+	assert.EqualValues(t, 1, sub.Stats().Failed)
+
+	other := newTestClient(t, "shutdown-other")
+	pending, err := other.PendingMessages(context.Background(), stream, group, 10)
+	if err != nil {
+		t.Fatalf("Error listing pending messages: %v", err)
+	}
+	assert.EqualValues(t, 1, len(pending))
+}
+
+func TestShutdownDropsDelayedRequeues(t *testing.T) {
+	ctx := context.Background()
+	stream := generate.RandomStringWithPrefix("SHUTSTREAM")
+	group := generate.RandomStringWithPrefix("SHUTGROUP")
+	c := newShutdownClient("shutdown-consumer")
+	messages := fetchPending(t, c, stream, group, 1)
+	_, err := c.Nack(ctx, messages[0], NackOptions{Mode: NackRequeue, Delay: time.Hour})
+	if err != nil {
+		t.Fatalf("Error nacking message: %v", err)
+	}
+	shutdownCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	assert.NoError(t, c.Shutdown(shutdownCtx))
+	_, err = c.Nack(ctx, messages[0], NackOptions{Mode: NackRequeue, Delay: time.Hour})
+	assert.Error(t, err)
+
+	// the message is left pending, to be reclaimed
+	other := newTestClient(t, "shutdown-other")
+	pending, err := other.PendingMessages(ctx, stream, group, 10)
+	if err != nil {
+		t.Fatalf("Error listing pending messages: %v", err)
+	}
+	assert.EqualValues(t, 1, len(pending))
+}
+
+func TestShutdownRejectsLateAsyncProduces(t *testing.T) {
+	c := newShutdownClient("shutdown-consumer")
+	closed := c.NewAckBatcher(AckBatcherConfig{})
+	assert.NoError(t, closed.Close(context.Background()))
+	// a closed batcher is not kept until Shutdown
+	c.lifecycle.mu.Lock()
+	assert.EqualValues(t, 0, len(c.lifecycle.ackBatchers))
+	c.lifecycle.mu.Unlock()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.NoError(t, c.Shutdown(shutdownCtx))
+	results := make(chan error, 1)
+	c.ProduceMessageAsync(context.Background(), generate.RandomStringWithPrefix("SHUTASYNC"), map[string]interface{}{"kind": "late"},
+		func(id string, err error) {
+			assert.Empty(t, id)
+			results <- err
+		})
+	assert.Error(t, <-results)
+	assert.NoError(t, c.FlushAsync(shutdownCtx))
+	// closing the connection Shutdown already closed does not panic
+	assert.NotPanics(t, c.CloseConnection)
+}
@@ -0,0 +1,46 @@
+package rediswrapper
+
+import "strings"
+
+// clusterSlots is the number of hash slots of a Redis Cluster
+const clusterSlots = 16384
+
+// HashSlot returns the Redis Cluster hash slot of a key. If the key contains a non empty hash tag
+// between { and }, only the tag is hashed, so keys sharing a tag always share a slot
+func HashSlot(key string) int {
+	if start := strings.IndexByte(key, '{'); start >= 0 {
+		if end := strings.IndexByte(key[start+1:], '}'); end > 0 {
+			key = key[start+1 : start+1+end]
+		}
+	}
+	return int(crc16(key) % clusterSlots)
+}
+
+// crc16 implements the CRC16-CCITT (XMODEM) checksum used by Redis Cluster
+func crc16(key string) uint16 {
+	var crc uint16
+	for i := 0; i < len(key); i++ {
+		crc ^= uint16(key[i]) << 8
+		for j := 0; j < 8; j++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x1021
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return crc
+}
+
+// sameSlot reports whether all keys map to the same hash slot, and the slot of every key
+func sameSlot(keys []string) (bool, []int) {
+	slots := make([]int, len(keys))
+	same := true
+	for i, key := range keys {
+		slots[i] = HashSlot(key)
+		if slots[i] != slots[0] {
+			same = false
+		}
+	}
+	return same, slots
+}
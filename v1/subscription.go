@@ -0,0 +1,401 @@
+package rediswrapper
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// MessageHandler is called for every message delivered by a Subscription.
+// returning nil acknowledges the message, returning an error leaves it pending so it can be reclaimed later,
+// unless the error was wrapped with NackWith
+type MessageHandler func(ctx context.Context, msg RedisStreamsMessage) error
+
+// ReclaimConfig controls the background recovery of messages that were delivered to a consumer but never acked
+// (for example because the pod that fetched them died). Reclaim is disabled when Interval is zero.
+type ReclaimConfig struct {
+	// Interval is how often the pending entries list is scanned
+	Interval time.Duration
+	// MinIdle is how long a message must stay pending before it is considered abandoned, 5 minutes by default.
+	// Keep it above the time it takes to handle a batch, or set LeaseConfig, so live consumers keep their messages
+	MinIdle time.Duration
+	// BatchSize is the maximum number of messages claimed per XAUTOCLAIM call
+	BatchSize int64
+}
+
+// SubscriptionConfig describes what a Subscription reads and how
+type SubscriptionConfig struct {
+	StreamName     string
+	ConsumerGroup  string
+	BatchSize      int
+	WaitForSeconds int
+	Reclaim        ReclaimConfig
+	Cleanup        ConsumerCleanupConfig
+	Idempotency    IdempotencyConfig
+	Lease          LeaseConfig
+	// ReleaseOnShutdown releases the messages fetched but not handled yet when the subscription stops, so other
+	// consumers can reclaim them right away instead of after ReclaimConfig.MinIdle
+	ReleaseOnShutdown bool
+}
+
+// SubscriptionStats is a snapshot of the counters kept by a Subscription
+type SubscriptionStats struct {
+	Processed        int64
+	Failed           int64
+	Recovered        int64
+	ReclaimScans     int64
+	RemovedConsumers int64
+	Duplicates       int64
+	LeasesLost       int64
+}
+
+// Subscription continuously fetches new messages for a consumer group and hands them to a MessageHandler,
+// acking each message the handler processed successfully.
+// If reclaim is configured it also periodically claims abandoned pending messages and feeds them to the same handler,
+// and if cleanup is configured it periodically removes stale consumers from the group.
+// If lease extension is configured, messages stay owned by this consumer for as long as their handler runs
+type Subscription struct {
+	client      *RedisStreamsClient
+	config      SubscriptionConfig
+	handler     MessageHandler
+	middlewares []Middleware
+	// pipeline is the handler wrapped with the middlewares, built when Run starts
+	pipeline MessageHandler
+	// handlerAcks is set when the handler acks messages itself, as the handler built by Process does
+	handlerAcks bool
+
+	processed        atomic.Int64
+	failed           atomic.Int64
+	recovered        atomic.Int64
+	reclaimScans     atomic.Int64
+	removedConsumers atomic.Int64
+	duplicates       atomic.Int64
+	leasesLost       atomic.Int64
+
+	// stopFetching, cancelHandlers and done are set by Run for Shutdown, done is closed when Run returns
+	mu             sync.Mutex
+	stopFetching   context.CancelFunc
+	cancelHandlers context.CancelFunc
+	done           chan struct{}
+	// fetched holds the IDs of the batch Run is dispatching, which reclaim must leave to Run
+	fetched map[string]struct{}
+}
+
+// Subscribe creates a new Subscription, call Run to start consuming
+// it requires the following parameters:
+// config: the stream, consumer group and polling settings of the subscription
+// handler: the function called for every fetched or reclaimed message
+func (r *RedisStreamsClient) Subscribe(config SubscriptionConfig, handler MessageHandler) *Subscription {
+	if config.BatchSize <= 0 {
+		config.BatchSize = 10
+	}
+	if config.WaitForSeconds <= 0 {
+		config.WaitForSeconds = 5
+	}
+	if config.Reclaim.Interval > 0 && config.Reclaim.BatchSize <= 0 {
+		config.Reclaim.BatchSize = 100
+	}
+	// a min idle of 0 would claim every pending message of the group, including those live consumers are handling
+	if config.Reclaim.Interval > 0 && config.Reclaim.MinIdle <= 0 {
+		config.Reclaim.MinIdle = 5 * time.Minute
+	}
+	if config.Cleanup.Interval > 0 && config.Cleanup.MaxIdle <= 0 {
+		config.Cleanup.MaxIdle = time.Hour
+	}
+	return &Subscription{
+		client:  r,
+		config:  config,
+		handler: handler,
+	}
+}
+
+// Run consumes messages until the context is cancelled or Shutdown is called, in which case it returns nil.
+// Cancelling the context also cancels the context of the handlers in flight, Shutdown lets them finish.
+// Note that when reclaim is enabled the handler may be called concurrently for new and reclaimed messages
+func (s *Subscription) Run(ctx context.Context) error {
+	if s.handler == nil {
+		return fmt.Errorf("subscription handler cannot be nil")
+	}
+	s.pipeline = chain(s.handler, s.middlewares)
+	err := s.client.ensureConsumerGroupExists(ctx, s.config.StreamName, s.config.ConsumerGroup)
+	if err != nil {
+		return fmt.Errorf("error ensuring consumer group exists: %v", err)
+	}
+	// handlers run with handlersCtx, fetching and reclaiming stop as soon as fetchCtx is done
+	handlersCtx, cancelHandlers := context.WithCancel(ctx)
+	defer cancelHandlers()
+	fetchCtx, stopFetching := context.WithCancel(handlersCtx)
+	defer stopFetching()
+	done := make(chan struct{})
+	defer close(done)
+	s.mu.Lock()
+	s.stopFetching, s.cancelHandlers, s.done = stopFetching, cancelHandlers, done
+	s.mu.Unlock()
+	if err = s.client.lifecycle.register(s); err != nil {
+		return fmt.Errorf("error starting subscription: %v", err)
+	}
+	defer s.client.lifecycle.unregister(s)
+	backgroundCtx, cancelBackground := context.WithCancel(fetchCtx)
+	var background sync.WaitGroup
+	defer func() {
+		cancelBackground()
+		background.Wait()
+	}()
+	if s.config.Reclaim.Interval > 0 {
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			runEvery(backgroundCtx, s.config.Reclaim.Interval, func(ctx context.Context) {
+				s.reclaimTick(ctx, handlersCtx)
+			})
+		}()
+	}
+	if s.config.Cleanup.Interval > 0 {
+		background.Add(1)
+		go func() {
+			defer background.Done()
+			runEvery(backgroundCtx, s.config.Cleanup.Interval, s.cleanupTick)
+		}()
+	}
+	for {
+		if fetchCtx.Err() != nil {
+			return nil
+		}
+		messages, err := s.client.FetchNewMessages(fetchCtx, s.config.StreamName, s.config.ConsumerGroup, s.config.BatchSize, s.config.WaitForSeconds)
+		if err != nil {
+			if fetchCtx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("error fetching messages for subscription: %v", err)
+		}
+		s.setFetched(messages)
+		s.dispatchAll(fetchCtx, handlersCtx, messages)
+		s.setFetched(nil)
+	}
+}
+
+// setFetched records the batch Run is dispatching. XAUTOCLAIM does not filter by owner, so without it the
+// messages of a batch waiting behind slow handlers would be reclaimed by this very subscription and handled twice
+func (s *Subscription) setFetched(messages []RedisStreamsMessage) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.fetched = make(map[string]struct{}, len(messages))
+	for _, message := range messages {
+		s.fetched[message.ID] = struct{}{}
+	}
+}
+
+// isFetched reports whether a message belongs to the batch Run is dispatching
+func (s *Subscription) isFetched(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.fetched[id]
+	return ok
+}
+
+// dispatchAll dispatches fetched messages in order until fetching is stopped. The messages not started by then
+// are left pending, or released when ReleaseOnShutdown is set
+func (s *Subscription) dispatchAll(fetchCtx context.Context, handlersCtx context.Context, messages []RedisStreamsMessage) {
+	for i, message := range messages {
+		if fetchCtx.Err() != nil {
+			if s.config.ReleaseOnShutdown {
+				s.release(messages[i:])
+			}
+			return
+		}
+		s.dispatch(handlersCtx, message)
+	}
+}
+
+// release hands messages that were not handled back to the group, for immediate reclaim by other consumers
+func (s *Subscription) release(messages []RedisStreamsMessage) {
+	// the subscription may be stopping because its context was cancelled, the release should still go through
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, message := range messages {
+		_, err := s.client.Nack(ctx, message, NackOptions{Mode: NackRelease, ReclaimMinIdle: s.config.Reclaim.MinIdle})
+		if err != nil {
+			log.Printf("Error releasing message %s on stream %s: %v\n", message.ID, message.StreamName, err)
+		}
+	}
+}
+
+// Stats returns the current counters of the subscription
+func (s *Subscription) Stats() SubscriptionStats {
+	return SubscriptionStats{
+		Processed:        s.processed.Load(),
+		Failed:           s.failed.Load(),
+		Recovered:        s.recovered.Load(),
+		ReclaimScans:     s.reclaimScans.Load(),
+		RemovedConsumers: s.removedConsumers.Load(),
+		Duplicates:       s.duplicates.Load(),
+		LeasesLost:       s.leasesLost.Load(),
+	}
+}
+
+// dispatch runs the handler for a single message and acks it if the handler succeeded.
+// With idempotency enabled, messages already processed are acked without calling the handler
+func (s *Subscription) dispatch(ctx context.Context, message RedisStreamsMessage) {
+	idempotencyKey := ""
+	if s.config.Idempotency.Store != nil {
+		idempotencyKey = s.config.Idempotency.idempotencyKey(message)
+		if !s.reserve(ctx, idempotencyKey, message) {
+			return
+		}
+	}
+	start := time.Now()
+	handlerCtx, span := s.client.StartProcessSpan(ctx, message)
+	var messageLease *lease
+	if s.config.Lease.Interval > 0 {
+		handlerCtx, messageLease = s.startLease(handlerCtx, message)
+	}
+	err := s.pipeline(handlerCtx, message)
+	// a message claimed by another consumer mid processing must not be acked, the new owner handles it
+	if messageLease != nil && messageLease.finish() {
+		s.leasesLost.Add(1)
+		if err == nil {
+			err = fmt.Errorf("lease of message %s was lost while handling it", message.ID)
+		}
+	}
+	endSpan(span, err)
+	s.client.observeHandler(message.StreamName, message.ConsumerGroup, start, err)
+	if err != nil {
+		s.failed.Add(1)
+		log.Printf("Handler failed for message %s on stream %s: %v\n", message.ID, message.StreamName, err)
+		if idempotencyKey != "" {
+			if releaseErr := s.config.Idempotency.Store.Release(context.Background(), idempotencyKey); releaseErr != nil {
+				log.Printf("Error releasing message %s on stream %s: %v\n", message.ID, message.StreamName, releaseErr)
+			}
+		}
+		if nackErr, ok := asNackError(err); ok {
+			s.nack(message, nackErr.Options)
+		}
+		return
+	}
+	s.processed.Add(1)
+	// the handler is done with the message, so the ack should go through even if the subscription is being cancelled
+	if idempotencyKey != "" {
+		err = s.config.Idempotency.Store.Complete(context.Background(), idempotencyKey, message)
+	} else if !s.handlerAcks {
+		err = s.client.AckMessage(context.Background(), message.StreamName, message.ConsumerGroup, message.ID)
+	}
+	if err != nil {
+		log.Printf("Error acking message %s on stream %s: %v\n", message.ID, message.StreamName, err)
+	}
+}
+
+// nack hands a failed message back as the handler asked with NackWith
+func (s *Subscription) nack(message RedisStreamsMessage, options NackOptions) {
+	if options.ReclaimMinIdle == 0 {
+		options.ReclaimMinIdle = s.config.Reclaim.MinIdle
+	}
+	if _, err := s.client.Nack(context.Background(), message, options); err != nil {
+		log.Printf("Error nacking message %s on stream %s: %v\n", message.ID, message.StreamName, err)
+	}
+}
+
+// reserve claims the idempotency key of a message and reports whether the handler should run.
+// Duplicates of processed messages are acked, messages in progress elsewhere are left pending
+func (s *Subscription) reserve(ctx context.Context, key string, message RedisStreamsMessage) bool {
+	result, err := s.config.Idempotency.Store.Reserve(ctx, key)
+	if err != nil {
+		s.failed.Add(1)
+		log.Printf("Error reserving message %s on stream %s: %v\n", message.ID, message.StreamName, err)
+		return false
+	}
+	switch result {
+	case AlreadyProcessed:
+		s.duplicates.Add(1)
+		log.Printf("Skipping duplicate message %s on stream %s\n", message.ID, message.StreamName)
+		err = s.client.AckMessage(context.Background(), message.StreamName, message.ConsumerGroup, message.ID)
+		if err != nil {
+			log.Printf("Error acking message %s on stream %s: %v\n", message.ID, message.StreamName, err)
+		}
+		return false
+	case InProgress:
+		log.Printf("Message %s on stream %s is being processed by another consumer\n", message.ID, message.StreamName)
+		return false
+	default:
+		return true
+	}
+}
+
+// runEvery calls fn on every tick of interval until the context is cancelled
+func runEvery(ctx context.Context, interval time.Duration, fn func(ctx context.Context)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			fn(ctx)
+		}
+	}
+}
+
+func (s *Subscription) reclaimTick(ctx context.Context, handlersCtx context.Context) {
+	recovered, err := s.reclaim(ctx, handlersCtx)
+	if err != nil && ctx.Err() == nil {
+		log.Printf("Error reclaiming messages on stream %s group %s: %v\n", s.config.StreamName, s.config.ConsumerGroup, err)
+	}
+	if recovered > 0 {
+		log.Printf("Recovered %d abandoned messages on stream %s group %s\n", recovered, s.config.StreamName, s.config.ConsumerGroup)
+	}
+}
+
+func (s *Subscription) cleanupTick(ctx context.Context) {
+	removed, err := s.client.RemoveStaleConsumers(ctx, s.config.StreamName, s.config.ConsumerGroup, s.config.Cleanup.MaxIdle, s.config.Cleanup.ReclaimPending)
+	s.removedConsumers.Add(int64(len(removed)))
+	if err != nil && ctx.Err() == nil {
+		log.Printf("Error removing stale consumers on stream %s group %s: %v\n", s.config.StreamName, s.config.ConsumerGroup, err)
+	}
+}
+
+// reclaim walks the whole pending entries list once, claiming every message idle for at least MinIdle
+// and passing it to the handler, which runs with handlersCtx. Messages of the batch Run is dispatching are skipped.
+// It returns the number of messages recovered
+func (s *Subscription) reclaim(ctx context.Context, handlersCtx context.Context) (int, error) {
+	s.reclaimScans.Add(1)
+	recovered := 0
+	start := "0-0"
+	for {
+		claimStart := time.Now()
+		messages, next, err := s.client.client.XAutoClaim(ctx, &redis.XAutoClaimArgs{
+			Stream:   s.config.StreamName,
+			Group:    s.config.ConsumerGroup,
+			Consumer: s.client.Config.ConsumerName,
+			MinIdle:  s.config.Reclaim.MinIdle,
+			Start:    start,
+			Count:    s.config.Reclaim.BatchSize,
+		}).Result()
+		s.client.observeOperation(OperationClaim, s.config.StreamName, s.config.ConsumerGroup, len(messages), claimStart, err)
+		if err != nil {
+			return recovered, fmt.Errorf("error auto claiming messages: %v", err)
+		}
+		claimed := make([]RedisStreamsMessage, 0, len(messages))
+		for i := range messages {
+			if s.isFetched(messages[i].ID) {
+				continue
+			}
+			message := s.client.transformXMessageToRedisStreamsMessage(&messages[i])
+			message.ConsumerName = s.client.Config.ConsumerName
+			message.ConsumerGroup = s.config.ConsumerGroup
+			message.StreamName = s.config.StreamName
+			claimed = append(claimed, message)
+		}
+		s.recovered.Add(int64(len(claimed)))
+		recovered += len(claimed)
+		s.dispatchAll(ctx, handlersCtx, claimed)
+		// a cursor of 0-0 means the whole pending entries list was scanned
+		if next == "0-0" || next == "" || ctx.Err() != nil {
+			return recovered, nil
+		}
+		start = next
+	}
+}
@@ -0,0 +1,139 @@
+package rediswrapper
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/a-agmon/redis-streams-wrapper/generate"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSubscriptionProcessesNewMessages(t *testing.T) {
+	c := newTestClient(t, "")
+	stream := generate.RandomStringWithPrefix("SUBSTREAM")
+	group := generate.RandomStringWithPrefix("SUBGROUP")
+	produceMessagesTo(t, c, stream, 5)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var mu sync.Mutex
+	received := 0
+	sub := c.Subscribe(SubscriptionConfig{StreamName: stream, ConsumerGroup: group, WaitForSeconds: 1},
+		func(ctx context.Context, msg RedisStreamsMessage) error {
+			mu.Lock()
+			defer mu.Unlock()
+			received++
+			if received == 5 {
+				cancel()
+			}
+			return nil
+		})
+	err := sub.Run(ctx)
+	if err != nil {
+		t.Fatalf("Error running subscription: %v", err)
+	}
+	assert.EqualValues(t, 5, sub.Stats().Processed)
+	// everything was acked so nothing is left to claim
+	claimed, err := c.ClaimMessagesNotAcked(context.Background(), stream, group, 10, 0)
+	if err != nil {
+		t.Fatalf("Error claiming messages: %v", err)
+	}
+	assert.EqualValues(t, 0, len(claimed))
+}
+
+func TestSubscriptionRecoversAbandonedMessages(t *testing.T) {
+	stream := generate.RandomStringWithPrefix("SUBSTREAM")
+	group := generate.RandomStringWithPrefix("SUBGROUP")
+	// a consumer fetches messages and dies before acking them
+	deadConsumer := newTestClient(t, "dead-consumer")
+	produceMessagesTo(t, deadConsumer, stream, 3)
+	messages, err := deadConsumer.FetchNewMessages(context.Background(), stream, group, 10, 1)
+	if err != nil {
+		t.Fatalf("Error polling for new messages: %v", err)
+	}
+	assert.EqualValues(t, 3, len(messages))
+
+	c := newTestClient(t, "live-consumer")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var mu sync.Mutex
+	recovered := make(map[string]bool)
+	sub := c.Subscribe(SubscriptionConfig{
+		StreamName:     stream,
+		ConsumerGroup:  group,
+		WaitForSeconds: 1,
+		Reclaim:        ReclaimConfig{Interval: 100 * time.Millisecond, MinIdle: 50 * time.Millisecond},
+	}, func(ctx context.Context, msg RedisStreamsMessage) error {
+		mu.Lock()
+		defer mu.Unlock()
+		assert.EqualValues(t, "live-consumer", msg.ConsumerName)
+		assert.EqualValues(t, group, msg.ConsumerGroup)
+		recovered[msg.ID] = true
+		if len(recovered) == 3 {
+			cancel()
+		}
+		return nil
+	})
+	err = sub.Run(ctx)
+	if err != nil {
+		t.Fatalf("Error running subscription: %v", err)
+	}
+	for _, message := range messages {
+		assert.True(t, recovered[message.ID])
+	}
+	stats := sub.Stats()
+	assert.EqualValues(t, 3, stats.Recovered)
+	assert.True(t, stats.ReclaimScans > 0)
+}
+
+func TestSubscriptionDefaultsReclaimMinIdle(t *testing.T) {
+	c := newTestClient(t, "")
+	sub := c.Subscribe(SubscriptionConfig{StreamName: "stream", ConsumerGroup: "group", Reclaim: ReclaimConfig{Interval: 30 * time.Second}},
+		func(ctx context.Context, msg RedisStreamsMessage) error { return nil })
+	assert.EqualValues(t, 5*time.Minute, sub.config.Reclaim.MinIdle)
+	sub = c.Subscribe(SubscriptionConfig{StreamName: "stream", ConsumerGroup: "group", Reclaim: ReclaimConfig{Interval: 30 * time.Second, MinIdle: time.Minute}},
+		func(ctx context.Context, msg RedisStreamsMessage) error { return nil })
+	assert.EqualValues(t, time.Minute, sub.config.Reclaim.MinIdle)
+}
+
+func TestSubscriptionDoesNotReclaimItsOwnFetchedMessages(t *testing.T) {
+	c := newTestClient(t, "slow-consumer")
+	stream := generate.RandomStringWithPrefix("SUBSTREAM")
+	group := generate.RandomStringWithPrefix("SUBGROUP")
+	produceMessagesTo(t, c, stream, 3)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var mu sync.Mutex
+	handled := make(map[string]int)
+	// the last messages of the batch wait in the PEL for longer than MinIdle while the first ones are handled
+	sub := c.Subscribe(SubscriptionConfig{
+		StreamName:     stream,
+		ConsumerGroup:  group,
+		BatchSize:      3,
+		WaitForSeconds: 1,
+		Reclaim:        ReclaimConfig{Interval: 10 * time.Millisecond, MinIdle: 20 * time.Millisecond},
+	}, func(ctx context.Context, msg RedisStreamsMessage) error {
+		time.Sleep(100 * time.Millisecond)
+		mu.Lock()
+		defer mu.Unlock()
+		handled[msg.ID]++
+		return nil
+	})
+	result := make(chan error, 1)
+	go func() {
+		result <- sub.Run(ctx)
+	}()
+	assert.Eventually(t, func() bool { return sub.Stats().Processed >= 3 }, 5*time.Second, 10*time.Millisecond)
+	// give the reclaim loop time to hand out any message twice
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+	assert.NoError(t, <-result)
+	mu.Lock()
+	defer mu.Unlock()
+	assert.EqualValues(t, 3, len(handled))
+	for id, count := range handled {
+		assert.EqualValues(t, 1, count, "message %s", id)
+	}
+	assert.EqualValues(t, 0, sub.Stats().Recovered)
+}
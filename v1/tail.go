@@ -0,0 +1,212 @@
+package rediswrapper
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// TailConfig describes what a Tailer reads
+type TailConfig struct {
+	// Streams are the streams to read, every message of each of them is delivered
+	Streams []string
+	// From is where streams without a checkpoint start: $ (the default) for messages added from now on,
+	// 0 for the beginning of the stream, or an ID to read after
+	From string
+	// CheckpointKey is a hash where the last ID read from every stream is stored, so a restarted Tailer resumes
+	// where it stopped. Checkpointing is disabled when empty
+	CheckpointKey string
+	// BatchSize is the maximum number of messages read per stream and call, 100 by default
+	BatchSize int
+	// WaitForSeconds is how long Next blocks for new messages, 5 by default. use -1 to not block at all
+	WaitForSeconds int
+}
+
+// Tailer reads every message of one or more streams without a consumer group, for consumers that need all messages
+// rather than a share of them (caches, fan-out). It tracks the last ID read from every stream itself
+type Tailer struct {
+	client  *RedisStreamsClient
+	config  TailConfig
+	lastIDs map[string]string
+}
+
+// Tail creates a Tailer, starting every stream from its checkpoint if one is stored, or from config.From.
+// A From of $ is resolved to the last entry of the stream right away, so nothing added between two reads is missed
+// it requires the following parameters:
+// config: the streams to read and where to start
+func (r *RedisStreamsClient) Tail(ctx context.Context, config TailConfig) (*Tailer, error) {
+	if len(config.Streams) == 0 {
+		return nil, fmt.Errorf("at least one stream is required")
+	}
+	if config.From == "" {
+		config.From = "$"
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = 100
+	}
+	if config.WaitForSeconds == 0 {
+		config.WaitForSeconds = 5
+	}
+	checkpoints := map[string]string{}
+	if config.CheckpointKey != "" {
+		var err error
+		checkpoints, err = r.client.HGetAll(ctx, config.CheckpointKey).Result()
+		if err != nil {
+			return nil, fmt.Errorf("error loading tail checkpoint %s: %v", config.CheckpointKey, err)
+		}
+	}
+	lastIDs := make(map[string]string, len(config.Streams))
+	for _, stream := range config.Streams {
+		if id, ok := checkpoints[stream]; ok {
+			lastIDs[stream] = id
+			continue
+		}
+		if config.From != "$" {
+			lastIDs[stream] = config.From
+			continue
+		}
+		last, err := r.ReadRangeReverse(ctx, stream, "+", "-", 1)
+		if err != nil {
+			return nil, err
+		}
+		lastIDs[stream] = "0-0"
+		if len(last) == 1 {
+			lastIDs[stream] = last[0].ID
+		}
+	}
+	return &Tailer{client: r, config: config, lastIDs: lastIDs}, nil
+}
+
+// Next returns the messages added to the streams after the last ones returned, blocking up to WaitForSeconds
+// if there are none. It returns an empty slice when the block time passed without new messages.
+// The checkpoint, if configured, is updated before returning
+func (t *Tailer) Next(ctx context.Context) ([]RedisStreamsMessage, error) {
+	messages, err := t.read(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return messages, t.Checkpoint(ctx)
+}
+
+// read reads the next messages and moves the last IDs past them
+func (t *Tailer) read(ctx context.Context) ([]RedisStreamsMessage, error) {
+	args := &redis.XReadArgs{
+		Streams: make([]string, 0, 2*len(t.config.Streams)),
+		Count:   int64(t.config.BatchSize),
+		Block:   -1,
+	}
+	args.Streams = append(args.Streams, t.config.Streams...)
+	for _, stream := range t.config.Streams {
+		args.Streams = append(args.Streams, t.lastIDs[stream])
+	}
+	if t.config.WaitForSeconds >= 0 {
+		args.Block = time.Duration(t.config.WaitForSeconds) * time.Second
+	}
+	start := time.Now()
+	streams, err := t.client.client.XRead(ctx, args).Result()
+	for _, stream := range t.config.Streams {
+		t.client.observeFetch(stream, "", streamResult(streams, stream), start, err)
+	}
+	if err == redis.Nil {
+		return []RedisStreamsMessage{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error tailing streams: %v", err)
+	}
+	messages := make([]RedisStreamsMessage, 0)
+	for _, stream := range streams {
+		if len(stream.Messages) == 0 {
+			continue
+		}
+		messages = append(messages, t.client.streamMessages(stream.Stream, stream.Messages)...)
+		t.lastIDs[stream.Stream] = stream.Messages[len(stream.Messages)-1].ID
+	}
+	return messages, nil
+}
+
+// Run calls handler for every message until the context is cancelled, in which case it returns nil.
+// The checkpoint is updated after every batch was handled. If the handler fails Run stops and returns the error,
+// the checkpoint then points to the last message handled successfully, so a restarted Tailer delivers the failed message again
+func (t *Tailer) Run(ctx context.Context, handler MessageHandler) error {
+	for {
+		if ctx.Err() != nil {
+			return nil
+		}
+		previousIDs := t.LastIDs()
+		messages, err := t.read(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		for i, message := range messages {
+			start := time.Now()
+			handlerCtx, span := t.client.StartProcessSpan(ctx, message)
+			err = handler(handlerCtx, message)
+			endSpan(span, err)
+			t.client.observeHandler(message.StreamName, "", start, err)
+			if err != nil {
+				t.rewind(previousIDs, messages[:i])
+				if checkpointErr := t.Checkpoint(context.Background()); checkpointErr != nil {
+					log.Printf("Error saving tail checkpoint %s: %v\n", t.config.CheckpointKey, checkpointErr)
+				}
+				return fmt.Errorf("handler failed for message %s on stream %s: %v", message.ID, message.StreamName, err)
+			}
+		}
+		if len(messages) > 0 {
+			// the batch was handled, so the checkpoint should be saved even if the tailer is being cancelled
+			if err = t.Checkpoint(context.Background()); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// rewind moves the last ID of every stream back to the last handled message, given the IDs before the batch
+func (t *Tailer) rewind(previousIDs map[string]string, handled []RedisStreamsMessage) {
+	for stream, id := range previousIDs {
+		t.lastIDs[stream] = id
+	}
+	for _, message := range handled {
+		t.lastIDs[message.StreamName] = message.ID
+	}
+}
+
+// Checkpoint stores the last ID read from every stream in the checkpoint key, it does nothing if checkpointing is disabled
+func (t *Tailer) Checkpoint(ctx context.Context) error {
+	if t.config.CheckpointKey == "" {
+		return nil
+	}
+	values := make([]interface{}, 0, 2*len(t.lastIDs))
+	for stream, id := range t.lastIDs {
+		values = append(values, stream, id)
+	}
+	err := t.client.client.HSet(ctx, t.config.CheckpointKey, values...).Err()
+	if err != nil {
+		return fmt.Errorf("error saving tail checkpoint %s: %v", t.config.CheckpointKey, err)
+	}
+	return nil
+}
+
+// LastIDs returns the ID of the last message read from every stream
+func (t *Tailer) LastIDs() map[string]string {
+	lastIDs := make(map[string]string, len(t.lastIDs))
+	for stream, id := range t.lastIDs {
+		lastIDs[stream] = id
+	}
+	return lastIDs
+}
+
+// streamResult returns the part of an XREAD reply for one stream
+func streamResult(streams []redis.XStream, stream string) []redis.XStream {
+	for i := range streams {
+		if streams[i].Stream == stream {
+			return streams[i : i+1]
+		}
+	}
+	return nil
+}
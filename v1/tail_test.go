@@ -0,0 +1,105 @@
+package rediswrapper
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/a-agmon/redis-streams-wrapper/generate"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTailFromNow(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t, "tailer")
+	stream := generate.RandomStringWithPrefix("TAILSTREAM")
+	produceMessagesTo(t, c, stream, 2)
+	tailer, err := c.Tail(ctx, TailConfig{Streams: []string{stream}, WaitForSeconds: -1})
+	if err != nil {
+		t.Fatalf("Error creating tailer: %v", err)
+	}
+	messages, err := tailer.Next(ctx)
+	if err != nil {
+		t.Fatalf("Error tailing: %v", err)
+	}
+	assert.EqualValues(t, 0, len(messages))
+	produceMessagesTo(t, c, stream, 3)
+	messages, err = tailer.Next(ctx)
+	if err != nil {
+		t.Fatalf("Error tailing: %v", err)
+	}
+	assert.EqualValues(t, 3, len(messages))
+	assert.EqualValues(t, messages[2].ID, tailer.LastIDs()[stream])
+}
+
+func TestTailManyStreamsWithCheckpoint(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t, "tailer")
+	orders := generate.RandomStringWithPrefix("TAILORDERS")
+	payments := generate.RandomStringWithPrefix("TAILPAYMENTS")
+	checkpoint := generate.RandomStringWithPrefix("TAILCHECKPOINT")
+	produceMessagesTo(t, c, orders, 2)
+	produceMessagesTo(t, c, payments, 1)
+	config := TailConfig{Streams: []string{orders, payments}, From: "0", CheckpointKey: checkpoint, WaitForSeconds: -1}
+	tailer, err := c.Tail(ctx, config)
+	if err != nil {
+		t.Fatalf("Error creating tailer: %v", err)
+	}
+	messages, err := tailer.Next(ctx)
+	if err != nil {
+		t.Fatalf("Error tailing: %v", err)
+	}
+	assert.EqualValues(t, 3, len(messages))
+
+	// a restarted tailer only sees what was added since the checkpoint
+	produceMessagesTo(t, c, payments, 1)
+	restarted, err := c.Tail(ctx, config)
+	if err != nil {
+		t.Fatalf("Error creating tailer: %v", err)
+	}
+	messages, err = restarted.Next(ctx)
+	if err != nil {
+		t.Fatalf("Error tailing: %v", err)
+	}
+	assert.EqualValues(t, 1, len(messages))
+	assert.EqualValues(t, payments, messages[0].StreamName)
+}
+
+func TestTailRunStopsAtFailedMessage(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t, "tailer")
+	stream := generate.RandomStringWithPrefix("TAILSTREAM")
+	checkpoint := generate.RandomStringWithPrefix("TAILCHECKPOINT")
+	produceMessagesTo(t, c, stream, 3)
+	config := TailConfig{Streams: []string{stream}, From: "0", CheckpointKey: checkpoint, WaitForSeconds: -1}
+	tailer, err := c.Tail(ctx, config)
+	if err != nil {
+		t.Fatalf("Error creating tailer: %v", err)
+	}
+	handled := make([]string, 0)
+	err = tailer.Run(ctx, func(ctx context.Context, msg RedisStreamsMessage) error {
+		if len(handled) == 1 {
+			return fmt.Errorf("boom")
+		}
+		handled = append(handled, msg.ID)
+		return nil
+	})
+	assert.ErrorContains(t, err, "boom")
+
+	restarted, err := c.Tail(ctx, config)
+	if err != nil {
+		t.Fatalf("Error creating tailer: %v", err)
+	}
+	messages, err := restarted.Next(ctx)
+	if err != nil {
+		t.Fatalf("Error tailing: %v", err)
+	}
+	assert.EqualValues(t, 2, len(messages))
+	assert.NotEqual(t, handled[0], messages[0].ID)
+}
+
+func TestTailRequiresStreams(t *testing.T) {
+	c := newTestClient(t, "tailer")
+	_, err := c.Tail(context.Background(), TailConfig{})
+	assert.Error(t, err)
+}
@@ -0,0 +1,108 @@
+package rediswrapper
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/a-agmon/redis-streams-wrapper"
+
+// payloadCarrier adapts a message payload to a propagation.TextMapCarrier so trace context travels as message fields
+type payloadCarrier map[string]interface{}
+
+func (c payloadCarrier) Get(key string) string {
+	return payloadString(c, key)
+}
+
+func (c payloadCarrier) Set(key string, value string) {
+	c[key] = value
+}
+
+func (c payloadCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for key := range c {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func (r *RedisStreamsClient) tracer() trace.Tracer {
+	provider := r.Config.TracerProvider
+	if provider == nil {
+		provider = otel.GetTracerProvider()
+	}
+	return provider.Tracer(tracerName)
+}
+
+func (r *RedisStreamsClient) propagator() propagation.TextMapPropagator {
+	if r.Config.Propagator != nil {
+		return r.Config.Propagator
+	}
+	return propagation.TraceContext{}
+}
+
+// startProducerSpan starts the span of a produce call and returns a copy of the payload carrying its trace context.
+// The caller's payload is never modified
+func (r *RedisStreamsClient) startProducerSpan(ctx context.Context, streamKey string, payload map[string]interface{}) (context.Context, trace.Span, map[string]interface{}) {
+	ctx, span := r.tracer().Start(ctx, streamKey+" publish",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(
+			attribute.String("messaging.system", "redis"),
+			attribute.String("messaging.operation", "publish"),
+			attribute.String("messaging.destination.name", streamKey),
+		))
+	if !span.SpanContext().IsValid() {
+		return ctx, span, payload
+	}
+	carrier := make(payloadCarrier, len(payload)+2)
+	for key, value := range payload {
+		carrier[key] = value
+	}
+	r.propagator().Inject(ctx, carrier)
+	return ctx, span, carrier
+}
+
+// endSpan records the outcome of an operation on its span and ends it
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// MessageTraceContext returns ctx enriched with the trace context the producer stored in the message fields,
+// use it to continue the producer's trace when processing messages returned by FetchNewMessages or ClaimMessagesNotAcked
+func (r *RedisStreamsClient) MessageTraceContext(ctx context.Context, msg RedisStreamsMessage) context.Context {
+	if msg.Properties == nil {
+		return ctx
+	}
+	return r.propagator().Extract(ctx, payloadCarrier(msg.Properties))
+}
+
+// StartProcessSpan starts a consumer span for processing a message, as a child of the producer's span
+// and linked to it. The caller must end the returned span once the message was handled
+func (r *RedisStreamsClient) StartProcessSpan(ctx context.Context, msg RedisStreamsMessage) (context.Context, trace.Span) {
+	producerCtx := r.MessageTraceContext(ctx, msg)
+	producerSpan := trace.SpanContextFromContext(producerCtx)
+	options := []trace.SpanStartOption{
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			attribute.String("messaging.system", "redis"),
+			attribute.String("messaging.operation", "process"),
+			attribute.String("messaging.destination.name", msg.StreamName),
+			attribute.String("messaging.message.id", msg.ID),
+			attribute.String("messaging.consumer.id", msg.ConsumerName),
+			attribute.String("messaging.redis.consumer_group", msg.ConsumerGroup),
+		),
+	}
+	if producerSpan.IsValid() {
+		options = append(options, trace.WithLinks(trace.Link{SpanContext: producerSpan}))
+	}
+	return r.tracer().Start(producerCtx, msg.StreamName+" process", options...)
+}
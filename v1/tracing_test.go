@@ -0,0 +1,85 @@
+package rediswrapper
+
+import (
+	"context"
+	"testing"
+
+	"github.com/a-agmon/redis-streams-wrapper/generate"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTracePropagationThroughMessages(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	c := NewRedisClientWrapper(RedisClientConfig{
+		Addr:           testRedisServer.Addr(),
+		ConsumerName:   "tracing-consumer",
+		TracerProvider: provider,
+	})
+	defer c.CloseConnection()
+	stream := generate.RandomStringWithPrefix("TRACESTREAM")
+	group := generate.RandomStringWithPrefix("TRACEGROUP")
+
+	payload := map[string]interface{}{"book": "The Sun Also Rises"}
+	err := c.ProduceMessage(context.Background(), stream, payload)
+	if err != nil {
+		t.Fatalf("Error producing message: %v", err)
+	}
+	// the caller's payload is left untouched
+	assert.EqualValues(t, map[string]interface{}{"book": "The Sun Also Rises"}, payload)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var handlerSpan trace.SpanContext
+	sub := c.Subscribe(SubscriptionConfig{StreamName: stream, ConsumerGroup: group, WaitForSeconds: 1},
+		func(ctx context.Context, msg RedisStreamsMessage) error {
+			assert.NotEmpty(t, msg.Properties["traceparent"])
+			handlerSpan = trace.SpanContextFromContext(ctx)
+			cancel()
+			return nil
+		})
+	err = sub.Run(ctx)
+	if err != nil {
+		t.Fatalf("Error running subscription: %v", err)
+	}
+
+	spans := exporter.GetSpans()
+	assert.EqualValues(t, 2, len(spans))
+	producer, consumer := spans[0], spans[1]
+	assert.EqualValues(t, trace.SpanKindProducer, producer.SpanKind)
+	assert.EqualValues(t, trace.SpanKindConsumer, consumer.SpanKind)
+	assert.EqualValues(t, producer.SpanContext.TraceID(), consumer.SpanContext.TraceID())
+	assert.EqualValues(t, producer.SpanContext.SpanID(), consumer.Parent.SpanID())
+	assert.EqualValues(t, 1, len(consumer.Links))
+	assert.EqualValues(t, producer.SpanContext.SpanID(), consumer.Links[0].SpanContext.SpanID())
+	assert.EqualValues(t, consumer.SpanContext.SpanID(), handlerSpan.SpanID())
+	assert.Contains(t, producer.Attributes, attribute.String("messaging.destination.name", stream))
+	assert.Contains(t, consumer.Attributes, attribute.String("messaging.operation", "process"))
+	assert.Contains(t, consumer.Attributes, attribute.String("messaging.redis.consumer_group", group))
+}
+
+func TestMessageTraceContextOnFetch(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	c := NewRedisClientWrapper(RedisClientConfig{Addr: testRedisServer.Addr(), TracerProvider: provider})
+	defer c.CloseConnection()
+	stream := generate.RandomStringWithPrefix("TRACESTREAM")
+	group := generate.RandomStringWithPrefix("TRACEGROUP")
+
+	parentCtx, parent := provider.Tracer("test").Start(context.Background(), "request")
+	err := c.ProduceMessage(parentCtx, stream, map[string]interface{}{"test": "test"})
+	parent.End()
+	if err != nil {
+		t.Fatalf("Error producing message: %v", err)
+	}
+	messages, err := c.FetchNewMessages(context.Background(), stream, group, 1, 1)
+	if err != nil {
+		t.Fatalf("Error polling for new messages: %v", err)
+	}
+	ctx := c.MessageTraceContext(context.Background(), messages[0])
+	assert.EqualValues(t, parent.SpanContext().TraceID(), trace.SpanContextFromContext(ctx).TraceID())
+}
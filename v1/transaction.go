@@ -0,0 +1,132 @@
+package rediswrapper
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// multiXAddScript adds one entry per key. It checks every key holds a stream and every entry has fields before
+// writing anything, so that either all entries are added or none is (Redis rolls back neither MULTI/EXEC nor scripts
+// on a runtime error). ARGV holds, for every key in order, the number of fields followed by the field/value pairs
+var multiXAddScript = redis.NewScript(`
+local check = 1
+for _, key in ipairs(KEYS) do
+	local keyType = redis.call('TYPE', key)['ok']
+	if keyType ~= 'stream' and keyType ~= 'none' then
+		return redis.error_reply('WRONGTYPE key ' .. key .. ' holds a ' .. keyType .. ' and not a stream')
+	end
+	local fieldCount = tonumber(ARGV[check])
+	if fieldCount == nil or fieldCount < 1 then
+		return redis.error_reply('EMPTYPAYLOAD message for key ' .. key .. ' has no fields')
+	end
+	check = check + fieldCount * 2 + 1
+end
+local ids = {}
+local pos = 1
+for i, key in ipairs(KEYS) do
+	local fieldCount = tonumber(ARGV[pos])
+	local fields = {}
+	for j = 1, fieldCount * 2 do
+		fields[j] = ARGV[pos + j]
+	end
+	pos = pos + fieldCount * 2 + 1
+	ids[i] = redis.call('XADD', key, '*', unpack(fields))
+end
+return ids
+`)
+
+// ProduceTx produces messages to one or more streams atomically, either all of them are added or none is.
+// Each message is produced to its StreamName with its Properties as payload, and the new IDs are returned in order.
+// When RedisClientConfig.ClusterMode is set all streams must share a hash slot, use the same hash tag
+// in their names (e.g. {order-17}.orders and {order-17}.audit)
+// it requires the following parameters:
+// messages: the messages to produce, their StreamName must be set
+func (r *RedisStreamsClient) ProduceTx(ctx context.Context, messages []RedisStreamsMessage) ([]string, error) {
+	if len(messages) == 0 {
+		return []string{}, nil
+	}
+	streams := make([]string, 0, len(messages))
+	txMessages := make([]RedisStreamsMessage, 0, len(messages))
+	for _, message := range messages {
+		if message.StreamName == "" {
+			return nil, fmt.Errorf("stream name cannot be empty")
+		}
+		if len(message.Properties) == 0 {
+			return nil, fmt.Errorf("payload of message for stream %s cannot be empty", message.StreamName)
+		}
+		streams = append(streams, message.StreamName)
+		txMessages = append(txMessages, RedisStreamsMessage{StreamName: message.StreamName, Properties: copyPayload(message.Properties)})
+	}
+	if r.Config.ClusterMode {
+		if same, slots := sameSlot(streams); !same {
+			return nil, fmt.Errorf("cannot produce atomically in cluster mode to streams %s, they map to hash slots %v: "+
+				"use the same hash tag in all stream names", strings.Join(streams, ", "), slots)
+		}
+	}
+	ids, err := r.produceWith(ctx, txMessages, r.xaddTx)
+	if err != nil {
+		if strings.HasPrefix(err.Error(), "CROSSSLOT") {
+			return nil, fmt.Errorf("cannot produce atomically to streams %s that are in different hash slots: %v", strings.Join(streams, ", "), err)
+		}
+		return nil, fmt.Errorf("error producing messages atomically: %v", err)
+	}
+	return ids, nil
+}
+
+// xaddTx is the last step of the atomic produce path
+func (r *RedisStreamsClient) xaddTx(ctx context.Context, messages []RedisStreamsMessage) ([]string, error) {
+	return r.runXAddScript(ctx, multiXAddScript, messages, nil, nil)
+}
+
+// runXAddScript runs a script adding one entry per message, with the message streams as its first keys followed by
+// extraKeys, and extraArgs as its first arguments followed by the fields of every message as multiXAddScript expects them
+func (r *RedisStreamsClient) runXAddScript(ctx context.Context, script *redis.Script, messages []RedisStreamsMessage,
+	extraKeys []string, extraArgs []interface{}) ([]string, error) {
+	start := time.Now()
+	keys := make([]string, 0, len(messages)+len(extraKeys))
+	args := append([]interface{}{}, extraArgs...)
+	spans := make([]trace.Span, 0, len(messages))
+	// an empty payload would fail its XADD after the previous entries were written, interceptors may have emptied it
+	for _, message := range messages {
+		if len(message.Properties) == 0 {
+			return make([]string, len(messages)), fmt.Errorf("payload of message for stream %s cannot be empty", message.StreamName)
+		}
+	}
+	for _, message := range messages {
+		_, span, payload := r.startProducerSpan(ctx, message.StreamName, message.Properties)
+		spans = append(spans, span)
+		keys = append(keys, message.StreamName)
+		args = append(args, len(payload))
+		for field, value := range payload {
+			args = append(args, field, value)
+		}
+	}
+	keys = append(keys, extraKeys...)
+	ids, err := script.Run(ctx, r.client, keys, args...).StringSlice()
+	if err == nil && len(ids) != len(messages) {
+		err = fmt.Errorf("expected %d messages to be produced, got %d", len(messages), len(ids))
+	}
+	perStream := make(map[string]int)
+	for i, span := range spans {
+		if err == nil {
+			span.SetAttributes(attribute.String("messaging.message.id", ids[i]))
+			log.Printf("Produced message %s to stream: %s\n", ids[i], messages[i].StreamName)
+		}
+		endSpan(span, err)
+		perStream[messages[i].StreamName]++
+	}
+	for stream, count := range perStream {
+		r.observeOperation(OperationProduce, stream, "", count, start, err)
+	}
+	if err != nil {
+		return make([]string, len(messages)), err
+	}
+	return ids, nil
+}
@@ -0,0 +1,106 @@
+package rediswrapper
+
+import (
+	"context"
+	"testing"
+
+	"github.com/a-agmon/redis-streams-wrapper/generate"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProduceTx(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t, "tx-producer")
+	orders := generate.RandomStringWithPrefix("TXORDERS")
+	audit := generate.RandomStringWithPrefix("TXAUDIT")
+	ids, err := c.ProduceTx(ctx, []RedisStreamsMessage{
+		{StreamName: orders, Properties: map[string]interface{}{"order": "A17", "amount": 250}},
+		{StreamName: audit, Properties: map[string]interface{}{"action": "order-created"}},
+		{StreamName: orders, Properties: map[string]interface{}{"order": "A18"}},
+	})
+	if err != nil {
+		t.Fatalf("Error producing messages: %v", err)
+	}
+	assert.EqualValues(t, 3, len(ids))
+	orderEntries, err := c.client.XRange(ctx, orders, "-", "+").Result()
+	if err != nil {
+		t.Fatalf("Error reading stream: %v", err)
+	}
+	assert.EqualValues(t, 2, len(orderEntries))
+	assert.EqualValues(t, ids[0], orderEntries[0].ID)
+	assert.EqualValues(t, map[string]interface{}{"order": "A17", "amount": "250"}, orderEntries[0].Values)
+	assert.EqualValues(t, ids[2], orderEntries[1].ID)
+	auditEntries, err := c.client.XRange(ctx, audit, "-", "+").Result()
+	if err != nil {
+		t.Fatalf("Error reading stream: %v", err)
+	}
+	assert.EqualValues(t, ids[1], auditEntries[0].ID)
+}
+
+func TestProduceTxIsAllOrNothing(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t, "tx-producer")
+	orders := generate.RandomStringWithPrefix("TXORDERS")
+	notAStream := generate.RandomStringWithPrefix("TXSTRING")
+	err := c.client.Set(ctx, notAStream, "value", 0).Err()
+	if err != nil {
+		t.Fatalf("Error setting key: %v", err)
+	}
+	_, err = c.ProduceTx(ctx, []RedisStreamsMessage{
+		{StreamName: orders, Properties: map[string]interface{}{"order": "A17"}},
+		{StreamName: notAStream, Properties: map[string]interface{}{"action": "order-created"}},
+	})
+	assert.Error(t, err)
+	length, err := c.client.XLen(ctx, orders).Result()
+	if err != nil {
+		t.Fatalf("Error reading stream length: %v", err)
+	}
+	assert.EqualValues(t, 0, length)
+}
+
+func TestProduceTxClusterMode(t *testing.T) {
+	ctx := context.Background()
+	c := NewRedisClientWrapper(RedisClientConfig{Addr: testRedisServer.Addr(), ConsumerName: "tx-producer", ClusterMode: true})
+	defer c.CloseConnection()
+	_, err := c.ProduceTx(ctx, []RedisStreamsMessage{
+		{StreamName: "orders", Properties: map[string]interface{}{"order": "A17"}},
+		{StreamName: "audit", Properties: map[string]interface{}{"action": "order-created"}},
+	})
+	assert.ErrorContains(t, err, "hash slots")
+	_, err = c.ProduceTx(ctx, []RedisStreamsMessage{
+		{StreamName: "{order-A17}.orders", Properties: map[string]interface{}{"order": "A17"}},
+		{StreamName: "{order-A17}.audit", Properties: map[string]interface{}{"action": "order-created"}},
+	})
+	assert.NoError(t, err)
+}
+
+func TestHashSlot(t *testing.T) {
+	// reference values from CLUSTER KEYSLOT
+	assert.EqualValues(t, 12182, HashSlot("foo"))
+	assert.EqualValues(t, 5061, HashSlot("bar"))
+	assert.EqualValues(t, HashSlot("user1000"), HashSlot("{user1000}.following"))
+	assert.EqualValues(t, HashSlot("{}.a"), HashSlot("{}.a"))
+	assert.NotEqual(t, HashSlot("{}.a"), HashSlot("{}.b"))
+}
+
+func TestProduceTxRejectsEmptyPayloads(t *testing.T) {
+	ctx := context.Background()
+	c := newTestClient(t, "tx-producer")
+	orders := generate.RandomStringWithPrefix("TXORDERS")
+	audit := generate.RandomStringWithPrefix("TXAUDIT")
+	_, err := c.ProduceTx(ctx, []RedisStreamsMessage{
+		{StreamName: orders, Properties: map[string]interface{}{"order": "A17"}},
+		{StreamName: audit, Properties: map[string]interface{}{}},
+	})
+	assert.ErrorContains(t, err, "cannot be empty")
+	// the script rejects it as well, before writing anything
+	_, err = multiXAddScript.Run(ctx, c.client, []string{orders, audit}, 1, "order", "A17", 0).Result()
+	assert.ErrorContains(t, err, "EMPTYPAYLOAD")
+	for _, stream := range []string{orders, audit} {
+		length, err := c.client.XLen(ctx, stream).Result()
+		if err != nil {
+			t.Fatalf("Error reading stream length: %v", err)
+		}
+		assert.EqualValues(t, 0, length)
+	}
+}